@@ -0,0 +1,79 @@
+// Command catchat serves the CatChat frontend and matchmaking hub.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Azeem01nnie/CatChat/pkg/hub"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func main() {
+	cfg, err := hub.LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal("invalid config", err)
+	}
+	slog.SetDefault(cfg.Logger(os.Stderr))
+
+	shutdownTracing, err := setupTracing(context.Background(), cfg.OTLPEndpoint, cfg.TraceSampleRatio)
+	if err != nil {
+		fatal("setting up tracing", err)
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	h, err := hub.New(cfg, hub.WithRegisterer(reg))
+	if err != nil {
+		fatal("starting hub", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", h.Handler())
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+
+	srv := &http.Server{Addr: cfg.Addr, Handler: mux}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		slog.Info("CatChat server started", "addr", cfg.Addr, "url", "http://localhost"+cfg.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("listening", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	slog.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Limits.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("http shutdown", "err", err)
+	}
+	if err := h.Shutdown(shutdownCtx); err != nil {
+		slog.Error("hub shutdown", "err", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("tracing shutdown", "err", err)
+	}
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
@@ -0,0 +1,124 @@
+// Package client defines the messages CatChat clients and servers
+// exchange over the WebSocket, as JSON objects, and the notice and close
+// codes servers send.
+package client
+
+import "encoding/json"
+
+// ---------------------- Messages ----------------------
+
+// Message is every frame either side sends. Type says which fields it
+// uses.
+type Message struct {
+	Type string `json:"type"`
+	// ID numbers chat messages within a pairing, on message, sent and ack
+	// messages.
+	ID   uint64 `json:"id,omitempty"`
+	From string `json:"from,omitempty"`
+	Text string `json:"text,omitempty"`
+	// Timestamp is when the server sent the message, in UTC and by
+	// default in RFC 3339 format, and Time the same in milliseconds since
+	// the Unix epoch. The session message that opens every connection
+	// carries them too, so clients can tell how far their clock is off.
+	Timestamp string `json:"timestamp,omitempty"`
+	Time      int64  `json:"time,omitempty"`
+	Bytes     int64  `json:"bytes,omitempty"`
+	// Interests lists the interests both sides share, on paired messages.
+	Interests []string `json:"interests,omitempty"`
+	// Reason is the client's explanation on report messages.
+	Reason string `json:"reason,omitempty"`
+	// Token is the client's session token on session messages, and its
+	// answer on challenge_response messages.
+	Token string `json:"token,omitempty"`
+	// Challenge is what the client must solve, on challenge messages.
+	Challenge *Challenge `json:"challenge,omitempty"`
+	// Code identifies the notice on server messages, with the values it
+	// mentions in Data; Text is then its rendering in the client's language.
+	Code string            `json:"code,omitempty"`
+	Data map[string]string `json:"data,omitempty"`
+	// Name is the sender's name in a group room.
+	Name string `json:"name,omitempty"`
+	// Stats are the presence counts on stats messages.
+	Stats *Stats `json:"stats,omitempty"`
+	// Media is the attachment on media messages.
+	Media *Media `json:"media,omitempty"`
+	// Rating is the client's verdict on rate_partner messages.
+	Rating *Rating `json:"rating,omitempty"`
+	// Signal is the WebRTC session description or ICE candidate on offer,
+	// answer and ice_candidate messages. The server relays it untouched.
+	Signal json.RawMessage `json:"signal,omitempty"`
+}
+
+// Message provenance, set by the server on every outbound message.
+const (
+	FromPartner = "partner"
+	FromMember  = "member"
+	FromServer  = "server"
+	FromBot     = "bot"
+)
+
+// Close codes for connections the server ends on purpose, from the range
+// RFC 6455 leaves to applications. Each follows a message of the matching
+// type, kicked, banned or timed_out, so clients know not to reconnect.
+const (
+	CloseKicked   = 4000
+	CloseBanned   = 4001
+	CloseTimedOut = 4002
+)
+
+// Stats tells a client how busy the server is: how many clients are
+// connected and how many of them are waiting on one of its interests. The
+// counts cover this instance only.
+type Stats struct {
+	Online  int `json:"online"`
+	Waiting int `json:"waiting"`
+}
+
+// Media is the attachment on media messages: inline Data for small files,
+// or the URL /upload returned.
+type Media struct {
+	// Type is the MIME type, detected by the server from the content.
+	Type string `json:"type,omitempty"`
+	Data []byte `json:"data,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+// Rating is the score, from 1 to 5, and optional flags on rate_partner
+// messages.
+type Rating struct {
+	Score int      `json:"score"`
+	Flags []string `json:"flags,omitempty"`
+}
+
+// RatingFlags are the flags a rating may carry; others are dropped.
+var RatingFlags = []string{"rude", "spam", "explicit", "bot"}
+
+// Valid reports whether the score is in range.
+func (r Rating) Valid() bool {
+	return r.Score >= 1 && r.Score <= 5
+}
+
+// KnownFlags returns r's flags that are in RatingFlags, once each.
+func (r Rating) KnownFlags() []string {
+	var flags []string
+	for _, f := range RatingFlags {
+		for _, g := range r.Flags {
+			if f == g {
+				flags = append(flags, f)
+				break
+			}
+		}
+	}
+	return flags
+}
+
+// Challenge is what a client is asked to solve. Kind says how to read the
+// rest: for "pow", find a Token such that the SHA-256 of Seed followed by
+// Token starts with Bits zero bits; for "captcha", have the user solve the
+// CAPTCHA for SiteKey and send its response token.
+type Challenge struct {
+	Kind    string `json:"kind"`
+	Seed    string `json:"seed,omitempty"`
+	Bits    int    `json:"bits,omitempty"`
+	SiteKey string `json:"siteKey,omitempty"`
+}
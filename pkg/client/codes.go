@@ -0,0 +1,71 @@
+package client
+
+// ---------------------- Notice Codes ----------------------
+
+// Every server message that tells the user something carries one of these
+// codes, naming exactly what happened, with the values it mentions in
+// Data, so clients can branch on it or word it themselves.
+// Notice codes.
+const (
+	CodeWaiting         = "WAITING"
+	CodeFallback        = "FALLBACK"
+	CodeBotPaired       = "BOT_PAIRED"
+	CodeBotHandoff      = "BOT_HANDOFF"
+	CodePaired          = "PAIRED"
+	CodePairedShared    = "PAIRED_SHARED"
+	CodeResumed         = "RESUMED"
+	CodePartnerLeft     = "PARTNER_LEFT"
+	CodePartnerNext     = "PARTNER_NEXT"
+	CodeReconnecting    = "PARTNER_RECONNECTING"
+	CodePartnerOnline   = "PARTNER_ONLINE"
+	CodePairEnded       = "PAIR_ENDED_BY_MODERATOR"
+	CodeNoPartner       = "NO_PARTNER"
+	CodeNoCallPartner   = "NO_CALL_PARTNER"
+	CodeNoReportPartner = "NO_REPORT_PARTNER"
+	CodeReportSaved     = "REPORT_SAVED"
+	CodeReportFailed    = "REPORT_FAILED"
+	CodeNudge           = "NUDGE"
+	CodeFindNewPartner  = "FIND_NEW_PARTNER"
+	CodeRateLimited     = "RATE_LIMITED"
+	CodeLanguageWarning = "LANGUAGE_WARNING"
+	CodeKickedRateLimit = "KICKED_RATE_LIMIT"
+	CodeKickedLanguage  = "KICKED_LANGUAGE"
+	CodeKickedModerator = "KICKED_MODERATOR"
+	CodeKickedFlood     = "KICKED_FLOOD"
+	CodeFloodWarning    = "FLOOD_WARNING"
+	CodeFloodMuted      = "FLOOD_MUTED"
+	CodeStillMuted      = "STILL_MUTED"
+	CodeLinkRemoved     = "LINK_REMOVED"
+	CodeLinkBlocked     = "LINK_BLOCKED"
+	CodeMessageFlagged  = "MESSAGE_FLAGGED"
+	CodeMessageRejected = "MESSAGE_REJECTED"
+	CodeKickedFilter    = "KICKED_FILTER"
+	CodeChallenge       = "CHALLENGE"
+	CodeChallengeFailed = "CHALLENGE_FAILED"
+	CodeKickedChallenge = "KICKED_CHALLENGE"
+	CodeIdleWarning     = "IDLE_WARNING"
+	CodeIdleTimeout     = "IDLE_TIMEOUT"
+	CodeSessionLimit    = "SESSION_LIMIT"
+	CodeBanned          = "BANNED"
+	CodeServerShutdown  = "SERVER_SHUTDOWN"
+	CodeMediaTooLarge   = "MEDIA_TOO_LARGE"
+	CodeMediaType       = "MEDIA_TYPE_NOT_ALLOWED"
+	CodeMediaRejected   = "MEDIA_REJECTED"
+	CodeMediaGone       = "MEDIA_GONE"
+	CodeSignalTooLarge  = "SIGNAL_TOO_LARGE"
+	CodeRoomJoined      = "ROOM_JOINED"
+	CodeRoomJoinedAlone = "ROOM_JOINED_ALONE"
+	CodeMemberJoined    = "MEMBER_JOINED"
+	CodeMemberLeft      = "MEMBER_LEFT"
+	CodeRoomNoNext      = "ROOM_NO_NEXT"
+	CodeRoomNoReport    = "ROOM_NO_REPORT"
+	CodeInvalidMessage  = "INVALID_MESSAGE"
+	CodeMessageTooLong  = "MESSAGE_TOO_LONG"
+	CodeInterestsSet    = "INTERESTS_SET"
+	CodeCooldown        = "COOLDOWN"
+	CodeInviteCreated   = "INVITE_CREATED"
+	CodeInviteInvalid   = "INVITE_INVALID"
+	CodeRoomNoInvite    = "ROOM_NO_INVITE"
+	CodeRatingSaved     = "RATING_SAVED"
+	CodeNoRatingPartner = "NO_RATING_PARTNER"
+)
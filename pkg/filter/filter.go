@@ -0,0 +1,91 @@
+// Package filter defines the chain of filters chat text goes through
+// before a CatChat hub relays it, and the built-in link policy.
+package filter
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// ---------------------- Message Filters ----------------------
+
+// Each filter in a chain sees the text as the ones before it left it. The
+// first to reject or kick ends the chain.
+
+// Verdict is what a filter decided about a message.
+type Verdict int
+
+const (
+	// Pass relays the message, with any changes made to its text.
+	Pass Verdict = iota
+	// Flag relays the message and then warns the sender.
+	Flag
+	// Reject drops the message and tells the sender why.
+	Reject
+	// Kick drops the message and disconnects the sender.
+	Kick
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Pass:
+		return "pass"
+	case Flag:
+		return "flag"
+	case Reject:
+		return "reject"
+	case Kick:
+		return "kick"
+	}
+	return fmt.Sprintf("Verdict(%d)", int(v))
+}
+
+// Message is a chat message on its way through the filters. Filters may
+// rewrite Text.
+type Message struct {
+	Text string
+	// Sender is the sending client's session ID and IP its address, which
+	// is invalid for clients hosted on other instances.
+	Sender string
+	IP     netip.Addr
+}
+
+// Result is a filter's decision. Code is the notice the sender is sent
+// for anything but Pass, rendered with Data; hubs register templates for
+// custom codes with RegisterLocale. Reason is the disconnect reason for
+// Kick, and Strike counts a strike against the sender's address as well,
+// which bans it once there are enough.
+type Result struct {
+	Verdict Verdict
+	Code    string
+	Data    map[string]string
+	Reason  string
+	Strike  bool
+}
+
+// Filter vets chat messages. Filters run on the senders' read goroutines,
+// so they must be safe for concurrent use.
+type Filter interface {
+	Filter(m *Message) Result
+}
+
+// Func adapts a function to a Filter.
+type Func func(m *Message) Result
+
+func (f Func) Filter(m *Message) Result { return f(m) }
+
+// Run passes m through filters in order, returning the verdict: that of
+// the filter that rejected or kicked, or else the first flag raised.
+func Run(filters []Filter, m *Message) Result {
+	var out Result
+	for _, f := range filters {
+		res := f.Filter(m)
+		if res.Verdict >= Reject {
+			return res
+		}
+		if res.Verdict == Flag && out.Verdict == Pass {
+			out = res
+		}
+	}
+	return out
+}
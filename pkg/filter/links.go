@@ -0,0 +1,110 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ---------------------- Link Policy ----------------------
+
+// Link modes.
+const (
+	LinksAllow  = "allow"
+	LinksStrip  = "strip"
+	LinksCensor = "censor"
+	LinksBlock  = "block"
+)
+
+// LinkMask is written in place of every censored link.
+const LinkMask = "[link]"
+
+// linkPattern finds links: anything with an http(s) or ftp scheme or a www.
+// host, and bare domains on the top-level domains link spam favours. Bare
+// domains on other TLDs are let through, since "file.txt" or "end.Next"
+// would otherwise be caught.
+var linkPattern = regexp.MustCompile(`(?i)(?:\b(?:https?|ftp)://|\bwww\.)[^\s<>"]+|\b(?:[a-z0-9-]+\.)+(?:com|net|org|info|biz|io|co|me|ly|gg|tv|xyz|ru|tk|top|app|dev|link|site|online|club|shop|live)\b(?:/[^\s<>"]*)?`)
+
+// LinkPolicy is what happens to links to hosts outside an allowlist.
+type LinkPolicy struct {
+	mode string
+	// allow holds lower-case domains whose links, and their subdomains',
+	// are left alone.
+	allow []string
+}
+
+// NewLinkPolicy checks mode and normalises the allowlist, accepting
+// "example.com", ".example.com" and "*.example.com" alike.
+func NewLinkPolicy(mode string, allow []string) (LinkPolicy, error) {
+	switch mode {
+	case LinksAllow, LinksStrip, LinksCensor, LinksBlock:
+	default:
+		return LinkPolicy{}, fmt.Errorf(`links must be "allow", "strip", "censor" or "block", got %q`, mode)
+	}
+	p := LinkPolicy{mode: mode}
+	var errs []error
+	for _, d := range allow {
+		d = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(d), "*"), ".")
+		if d == "" || strings.ContainsAny(d, "/:*@ ") {
+			errs = append(errs, fmt.Errorf("link-allowlist: invalid domain %q", d))
+			continue
+		}
+		p.allow = append(p.allow, d)
+	}
+	return p, errors.Join(errs...)
+}
+
+// Mode is the policy's link mode.
+func (p LinkPolicy) Mode() string {
+	return p.mode
+}
+
+// Allowed reports whether link points at an allowlisted host.
+func (p LinkPolicy) Allowed(link string) bool {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for _, d := range p.allow {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rewrite strips or censors the links in text to hosts that aren't
+// allowlisted, as the mode says; block mode strips them. found reports
+// whether there were any.
+func (p LinkPolicy) Rewrite(text string) (out string, found bool) {
+	if p.mode == LinksAllow {
+		return text, false
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range linkPattern.FindAllStringIndex(text, -1) {
+		start, end := loc[0], loc[1]
+		// Sentence punctuation after a link is not part of it.
+		end = start + len(strings.TrimRight(text[start:end], ".,;:!?)]}'\""))
+		if p.Allowed(text[start:end]) {
+			continue
+		}
+		found = true
+		b.WriteString(text[last:start])
+		if p.mode == LinksCensor {
+			b.WriteString(LinkMask)
+		}
+		last = end
+	}
+	if !found {
+		return text, false
+	}
+	b.WriteString(text[last:])
+	return b.String(), true
+}
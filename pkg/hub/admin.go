@@ -0,0 +1,289 @@
+package hub
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------------------- Admin API ----------------------
+
+// requireAdmin only lets through requests carrying the configured bearer
+// token. With no token configured the admin API is disabled entirely.
+func requireAdmin(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="catchat-admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *Hub) adminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/reports", h.handleReports)
+	mux.HandleFunc("/admin/reports/confirm", h.handleConfirmReport)
+	mux.HandleFunc("/admin/clients", h.handleClients)
+	mux.HandleFunc("/admin/queues", h.handleQueues)
+	mux.HandleFunc("/admin/pairs", h.handlePairs)
+	mux.HandleFunc("/admin/disconnect", h.handleDisconnect)
+	mux.HandleFunc("/admin/unpair", h.handleUnpair)
+	mux.HandleFunc("/admin/wordlist/reload", h.handleReloadWordList)
+	mux.HandleFunc("/admin/bans", h.handleBans)
+	mux.HandleFunc("/admin/ratings", h.handleRatings)
+	mux.HandleFunc("/admin/observe", h.handleObserve)
+	return requireAdmin(token, mux)
+}
+
+// handleClients serves GET /admin/clients.
+func (h *Hub) handleClients(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, h.Snapshot().Clients)
+}
+
+// handleQueues serves GET /admin/queues: waiting session IDs per interest.
+func (h *Hub) handleQueues(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, h.Snapshot().Waiting)
+}
+
+// handlePairs serves GET /admin/pairs.
+func (h *Hub) handlePairs(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, h.Snapshot().Pairs)
+}
+
+type clientIDRequest struct {
+	ID string `json:"id"`
+}
+
+// handleDisconnect serves POST /admin/disconnect {"id": "..."}.
+func (h *Hub) handleDisconnect(w http.ResponseWriter, r *http.Request) {
+	h.handleClientAction(w, r, h.Disconnect)
+}
+
+// handleUnpair serves POST /admin/unpair {"id": "..."}, where id is either
+// member of the pair.
+func (h *Hub) handleUnpair(w http.ResponseWriter, r *http.Request) {
+	h.handleClientAction(w, r, h.BreakPair)
+}
+
+// handleReloadWordList serves POST /admin/wordlist/reload, rereading the
+// profanity word list file without waiting for the next poll.
+func (h *Hub) handleReloadWordList(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	n, err := h.words.Reload()
+	switch {
+	case errors.Is(err, errNoWordList):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		slog.Error("reloading word list", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		slog.Info("reloaded word list", "words", n)
+		writeJSON(w, http.StatusOK, map[string]int{"words": n})
+	}
+}
+
+type banRequest struct {
+	// CIDR is a single address or a range.
+	CIDR   string `json:"cidr"`
+	Reason string `json:"reason"`
+	// Duration is a Go duration such as "24h"; empty bans for good.
+	Duration string `json:"duration"`
+}
+
+// handleBans serves GET /admin/bans, POST /admin/bans {"cidr": "...",
+// "reason": "...", "duration": "24h"} and DELETE /admin/bans?id=N. New
+// bans disconnect matching clients straight away.
+func (h *Hub) handleBans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, h.bans.List())
+
+	case http.MethodPost:
+		var req banRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+			http.Error(w, `expected {"cidr": "<address or range>", "reason": "...", "duration": "<optional>"}`, http.StatusBadRequest)
+			return
+		}
+		prefix, err := parseBanTarget(req.CIDR)
+		if err != nil {
+			http.Error(w, "invalid cidr: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		var d time.Duration
+		if req.Duration != "" {
+			if d, err = time.ParseDuration(req.Duration); err != nil || d <= 0 {
+				http.Error(w, "duration must be a positive Go duration", http.StatusBadRequest)
+				return
+			}
+		}
+		ban, err := h.addBan(r.Context(), prefix, req.Reason, d)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusCreated, ban)
+
+	case http.MethodDelete:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+		switch err := h.bans.Remove(r.Context(), id); {
+		case errors.Is(err, ErrBanNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case err != nil:
+			slog.Error("removing ban", "err", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Hub) handleClientAction(w http.ResponseWriter, r *http.Request, action func(id string) error) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req clientIDRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil || req.ID == "" {
+		http.Error(w, `expected {"id": "<session id>"}`, http.StatusBadRequest)
+		return
+	}
+	switch err := action(req.ID); {
+	case errors.Is(err, ErrClientNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrNotPaired):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+// handleReports serves GET /admin/reports (newest first, ?limit=N) and
+// GET /admin/reports?id=N for a single report.
+func (h *Hub) handleReports(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	if idParam := r.URL.Query().Get("id"); idParam != "" {
+		id, err := strconv.ParseInt(idParam, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+		report, err := h.reports.Get(r.Context(), id)
+		if errors.Is(err, ErrReportNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			slog.Error("loading report", "err", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	reports, err := h.reports.List(r.Context(), limit)
+	if err != nil {
+		slog.Error("listing reports", "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if reports == nil {
+		reports = []Report{}
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+type reportIDRequest struct {
+	ID int64 `json:"id"`
+}
+
+// handleConfirmReport serves POST /admin/reports/confirm {"id": N},
+// upholding the report and giving the reported address a strike.
+func (h *Hub) handleConfirmReport(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req reportIDRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil || req.ID < 1 {
+		http.Error(w, `expected {"id": <report id>}`, http.StatusBadRequest)
+		return
+	}
+	report, err := h.reports.Confirm(r.Context(), req.ID)
+	switch {
+	case errors.Is(err, ErrReportNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, ErrReportConfirmed):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		slog.Error("confirming report", "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	ip, _ := netip.ParseAddr(report.ReportedIP)
+	banned := h.strike(ip, "confirmed report")
+	writeJSON(w, http.StatusOK, map[string]any{"report": report, "banned": banned})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("writing response", "err", err)
+	}
+}
@@ -0,0 +1,206 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Hub Backends ----------------------
+
+// HubBackend holds the waiting pool the hub matches against and carries
+// events to partners hosted on other instances. The in-memory backend keeps
+// everything in this process; the Redis backend shares the pool between
+// instances.
+type HubBackend interface {
+	// Instance identifies this process to other instances.
+	Instance() string
+	// Match takes the entry sharing the most interests with e out of the
+	// pool, preferring the longest-waiting one on ties, and returns it with
+	// the shared interests. Entries that avoid e, or that e avoids, are
+	// skipped. If nobody shares any interest, the longest-waiting entry
+	// that has waited at least generalAfter is taken instead: those are in
+	// the general pool and match anyone. Failing that, e is added to the
+	// pool, keeping its original place if it was already there.
+	Match(ctx context.Context, e waitEntry, generalAfter time.Duration) (w waitEntry, shared []string, ok bool, err error)
+	// MatchAny takes the longest-waiting entry other than e that has waited
+	// at least minWait, pairing regardless of interests. It prefers entries
+	// that neither side avoids but falls back to the others. e is put back
+	// in the pool if it has gone missing.
+	MatchAny(ctx context.Context, e waitEntry, minWait time.Duration) (w waitEntry, ok bool, err error)
+	Remove(ctx context.Context, id string) error
+	// Publish sends ev to the given instance.
+	Publish(ctx context.Context, instance string, ev peerEvent) error
+	// Events delivers events published to this instance.
+	Events() <-chan peerEvent
+	Close() error
+}
+
+var errNoPeers = errors.New("in-memory backend has no peers")
+
+// waitEntry is a waiting client as the pool sees it.
+type waitEntry struct {
+	ID        string
+	Instance  string
+	Interests []string
+	Since     time.Time
+	// Avoid lists recent partners this client should not be matched with
+	// again by interest.
+	Avoid []string
+}
+
+// avoids reports whether either of a and b is avoiding the other.
+func avoids(a, b waitEntry) bool {
+	for _, id := range a.Avoid {
+		if id == b.ID {
+			return true
+		}
+	}
+	for _, id := range b.Avoid {
+		if id == a.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// peerEvent is sent between instances about a pairing that spans them.
+// From is the sending instance's client and To the receiving one's.
+type peerEvent struct {
+	// Kind is "pair", "relay", "unpair" or "presence".
+	Kind     string `json:"kind"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Instance string `json:"instance"`
+	// Interests are the sender's interests on pair events.
+	Interests []string `json:"interests,omitempty"`
+	// Shared lists the interests both sides share, on pair events.
+	Shared []string `json:"shared,omitempty"`
+	// Message is the relayed message on relay events, and on presence
+	// events the notice for the receiving client, rendered in its language
+	// on its own instance.
+	Message *client.Message `json:"message,omitempty"`
+	// Reason is the notice code shown to the receiving client on unpair
+	// events.
+	Reason string `json:"reason,omitempty"`
+}
+
+// ---------------------- In-Memory Backend ----------------------
+
+type memoryBackend struct {
+	mu sync.Mutex
+	// entries are kept in order of Since, so the first match found is the
+	// longest-waiting one and a low-rating penalty pushes an entry back.
+	entries []waitEntry
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{}
+}
+
+func (b *memoryBackend) Instance() string { return "local" }
+
+func (b *memoryBackend) Match(ctx context.Context, e waitEntry, generalAfter time.Duration) (waitEntry, []string, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	best, general := -1, -1
+	var bestShared []string
+	now := time.Now()
+	for i, w := range b.entries {
+		if w.ID == e.ID || avoids(e, w) {
+			continue
+		}
+		if shared := sharedInterests(e.Interests, w.Interests); len(shared) > len(bestShared) {
+			best, bestShared = i, shared
+		}
+		if general < 0 && now.Sub(w.Since) >= generalAfter {
+			general = i
+		}
+	}
+	if best < 0 {
+		best = general
+	}
+	if best < 0 {
+		if b.index(e.ID) < 0 {
+			b.add(e)
+		}
+		return waitEntry{}, nil, false, nil
+	}
+	w := b.entries[best]
+	b.take(w.ID)
+	b.take(e.ID)
+	return w, bestShared, true, nil
+}
+
+func (b *memoryBackend) MatchAny(ctx context.Context, e waitEntry, minWait time.Duration) (waitEntry, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.index(e.ID) < 0 {
+		b.add(e)
+		return waitEntry{}, false, nil
+	}
+	now := time.Now()
+	fallback := -1
+	for i, w := range b.entries {
+		if w.ID == e.ID || now.Sub(w.Since) < minWait {
+			continue
+		}
+		if !avoids(e, w) {
+			fallback = i
+			break
+		}
+		if fallback < 0 {
+			fallback = i
+		}
+	}
+	if fallback < 0 {
+		return waitEntry{}, false, nil
+	}
+	w := b.entries[fallback]
+	b.take(w.ID)
+	b.take(e.ID)
+	return w, true, nil
+}
+
+func (b *memoryBackend) Remove(ctx context.Context, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.take(id)
+	return nil
+}
+
+func (b *memoryBackend) Publish(ctx context.Context, instance string, ev peerEvent) error {
+	return errNoPeers
+}
+
+// Events returns a nil channel: nothing is ever published to a single
+// instance.
+func (b *memoryBackend) Events() <-chan peerEvent { return nil }
+
+func (b *memoryBackend) Close() error { return nil }
+
+// add inserts e after every entry that has waited at least as long.
+func (b *memoryBackend) add(e waitEntry) {
+	i := sort.Search(len(b.entries), func(i int) bool { return b.entries[i].Since.After(e.Since) })
+	b.entries = slices.Insert(b.entries, i, e)
+}
+
+func (b *memoryBackend) index(id string) int {
+	for i, w := range b.entries {
+		if w.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (b *memoryBackend) take(id string) {
+	if i := b.index(id); i >= 0 {
+		b.entries = append(b.entries[:i], b.entries[i+1:]...)
+	}
+}
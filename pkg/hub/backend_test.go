@@ -0,0 +1,54 @@
+package hub
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryBackendPenaltyLosesTies(t *testing.T) {
+	b := newMemoryBackend()
+	ctx := context.Background()
+	now := time.Now()
+	// The penalised waiter arrived first, but its penalty puts it behind
+	// one that arrived later. Avoid keeps the two from matching each other.
+	penalised := waitEntry{ID: "low", Interests: []string{"cats"}, Since: now.Add(-2*time.Second + 20*time.Second), Avoid: []string{"normal"}}
+	normal := waitEntry{ID: "normal", Interests: []string{"cats"}, Since: now.Add(-time.Second)}
+	for _, e := range []waitEntry{penalised, normal} {
+		if _, _, ok, _ := b.Match(ctx, e, time.Hour); ok {
+			t.Fatalf("%s matched on arrival", e.ID)
+		}
+	}
+
+	w, shared, ok, err := b.Match(ctx, waitEntry{ID: "new", Interests: []string{"cats"}, Since: now}, time.Hour)
+	if err != nil || !ok {
+		t.Fatalf("Match = %v, %v", ok, err)
+	}
+	if w.ID != "normal" || len(shared) != 1 {
+		t.Errorf("matched %s sharing %v, want normal sharing [cats]", w.ID, shared)
+	}
+}
+
+func TestMemoryBackendGeneralOldestFirst(t *testing.T) {
+	b := newMemoryBackend()
+	ctx := context.Background()
+	now := time.Now()
+	for _, e := range []waitEntry{
+		{ID: "newer", Interests: []string{"dogs"}, Since: now.Add(-time.Minute)},
+		{ID: "older", Interests: []string{"birds"}, Since: now.Add(-2 * time.Minute)},
+		{ID: "penalised", Interests: []string{"fish"}, Since: now.Add(-3*time.Minute + 2*time.Minute + 30*time.Second)},
+	} {
+		if _, _, ok, _ := b.Match(ctx, e, time.Hour); ok {
+			t.Fatalf("%s matched on arrival", e.ID)
+		}
+	}
+
+	w, _, ok, _ := b.Match(ctx, waitEntry{ID: "new", Interests: []string{"cats"}, Since: now}, 10*time.Second)
+	if !ok || w.ID != "older" {
+		t.Errorf("general match = %s, %v, want older", w.ID, ok)
+	}
+	w, ok, _ = b.MatchAny(ctx, waitEntry{ID: "newer", Since: now.Add(-time.Minute)}, 0)
+	if !ok || w.ID != "penalised" {
+		t.Errorf("MatchAny = %s, %v, want penalised", w.ID, ok)
+	}
+}
@@ -0,0 +1,376 @@
+package hub
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Bans ----------------------
+
+// Ban keeps an address range out until ExpiresAt, or for good if it is nil.
+type Ban struct {
+	ID        int64        `json:"id"`
+	Prefix    netip.Prefix `json:"cidr"`
+	Reason    string       `json:"reason"`
+	CreatedAt time.Time    `json:"createdAt"`
+	ExpiresAt *time.Time   `json:"expiresAt,omitempty"`
+}
+
+func (b Ban) active(now time.Time) bool {
+	return b.ExpiresAt == nil || now.Before(*b.ExpiresAt)
+}
+
+var ErrBanNotFound = errors.New("ban not found")
+
+// BanStore persists bans across restarts.
+type BanStore interface {
+	Add(ctx context.Context, b *Ban) error
+	Remove(ctx context.Context, id int64) error
+	// List returns the bans that have not expired yet.
+	List(ctx context.Context) ([]Ban, error)
+	Close() error
+}
+
+// banList is the copy of the bans every connection is checked against,
+// kept in step with the store behind it.
+type banList struct {
+	store BanStore
+
+	mu   sync.RWMutex
+	bans []Ban
+}
+
+func loadBanList(ctx context.Context, store BanStore) (*banList, error) {
+	bans, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &banList{store: store, bans: bans}, nil
+}
+
+// Check returns the ban covering ip, if any.
+func (l *banList) Check(ip netip.Addr) (Ban, bool) {
+	now := time.Now()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, b := range l.bans {
+		if b.active(now) && b.Prefix.Contains(ip) {
+			return b, true
+		}
+	}
+	return Ban{}, false
+}
+
+func (l *banList) Add(ctx context.Context, b *Ban) error {
+	if err := l.store.Add(ctx, b); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bans = append(l.prune(), *b)
+	return nil
+}
+
+func (l *banList) Remove(ctx context.Context, id int64) error {
+	if err := l.store.Remove(ctx, id); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bans := l.prune()
+	for i, b := range bans {
+		if b.ID == id {
+			bans = append(bans[:i], bans[i+1:]...)
+			break
+		}
+	}
+	l.bans = bans
+	return nil
+}
+
+// List returns the bans in force, oldest first.
+func (l *banList) List() []Ban {
+	now := time.Now()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	out := []Ban{}
+	for _, b := range l.bans {
+		if b.active(now) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// prune drops expired bans. l.mu must be held for writing.
+func (l *banList) prune() []Ban {
+	now := time.Now()
+	kept := l.bans[:0]
+	for _, b := range l.bans {
+		if b.active(now) {
+			kept = append(kept, b)
+		}
+	}
+	return kept
+}
+
+// parseBanTarget accepts a single address or a CIDR range.
+func parseBanTarget(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		return p.Masked(), err
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	ip = ip.Unmap()
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
+
+// remoteIP is the address a request's connection came from.
+func remoteIP(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, _ := netip.ParseAddr(host)
+	return ip.Unmap()
+}
+
+// clientIP is the address of the user behind a request. When it came
+// through trusted proxies, that is the last X-Forwarded-For entry they
+// didn't add themselves; anything before it could have been forged by the
+// client.
+func (h *Hub) clientIP(r *http.Request) netip.Addr {
+	ip := remoteIP(r)
+	if !h.trusted(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = hop.Unmap()
+		if !h.trusted(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+func (h *Hub) trusted(ip netip.Addr) bool {
+	for _, p := range h.trustedProxies {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipString formats ip for storage, leaving it empty for proxies and other
+// clients without an address.
+func ipString(ip netip.Addr) string {
+	if !ip.IsValid() {
+		return ""
+	}
+	return ip.String()
+}
+
+// addBan bans prefix for d, or for good if d is 0, and disconnects the
+// clients it covers. It must not be called from the run loop.
+func (h *Hub) addBan(ctx context.Context, prefix netip.Prefix, reason string, d time.Duration) (*Ban, error) {
+	ban := &Ban{Prefix: prefix, Reason: truncateRunes(reason, h.limits.MaxReasonLength), CreatedAt: time.Now()}
+	if d > 0 {
+		expires := ban.CreatedAt.Add(d)
+		ban.ExpiresAt = &expires
+	}
+	if err := h.bans.Add(ctx, ban); err != nil {
+		slog.Error("adding ban", "err", err)
+		return nil, err
+	}
+	h.notifyBan(ban, false)
+	h.do(func() { h.enforceBan(*ban) })
+	return ban, nil
+}
+
+// notifyBan sends the user_banned webhook for b.
+func (h *Hub) notifyBan(b *Ban, automatic bool) {
+	h.webhooks.send(EventUserBanned, userBannedEvent{
+		BanID:     b.ID,
+		CIDR:      b.Prefix.String(),
+		Reason:    b.Reason,
+		ExpiresAt: b.ExpiresAt,
+		Automatic: automatic,
+	})
+}
+
+// enforceBan disconnects the clients b covers with a banned message, which
+// says in Data until when for bans that expire. It runs on the run loop.
+func (h *Hub) enforceBan(b Ban) {
+	var data map[string]string
+	if b.ExpiresAt != nil {
+		data = map[string]string{"until": b.ExpiresAt.UTC().Format(time.RFC3339)}
+	}
+	var banned []*Client
+	for c := range h.clients {
+		if b.Prefix.Contains(c.ip) {
+			banned = append(banned, c)
+		}
+	}
+	// Partners outside the prefix are only requeued once everyone banned is
+	// gone, so none of them is matched with a client about to be removed.
+	var requeue []*Client
+	for _, c := range banned {
+		if p := h.detach(c, client.CodePartnerLeft); p != nil && !b.Prefix.Contains(p.ip) {
+			requeue = append(requeue, p)
+		}
+		h.eject(c, client.CloseBanned, "banned", h.notice("banned", client.CodeBanned, data))
+	}
+	for _, p := range requeue {
+		h.match(p)
+	}
+}
+
+// ---------------------- In-Memory Ban Store ----------------------
+
+type memoryBanStore struct {
+	mu     sync.Mutex
+	bans   map[int64]Ban
+	nextID int64
+}
+
+func newMemoryBanStore() *memoryBanStore {
+	return &memoryBanStore{bans: make(map[int64]Ban)}
+}
+
+func (s *memoryBanStore) Add(_ context.Context, b *Ban) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	b.ID = s.nextID
+	s.bans[b.ID] = *b
+	return nil
+}
+
+func (s *memoryBanStore) Remove(_ context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.bans[id]; !ok {
+		return ErrBanNotFound
+	}
+	delete(s.bans, id)
+	return nil
+}
+
+func (s *memoryBanStore) List(_ context.Context) ([]Ban, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var out []Ban
+	for _, b := range s.bans {
+		if b.active(now) {
+			out = append(out, b)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (s *memoryBanStore) Close() error { return nil }
+
+// ---------------------- SQLite Ban Store ----------------------
+
+type sqliteBanStore struct {
+	db *sql.DB
+}
+
+func openSQLiteBanStore(path string) (*sqliteBanStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS bans (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		prefix     TEXT NOT NULL,
+		reason     TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteBanStore{db: db}, nil
+}
+
+func (s *sqliteBanStore) Add(ctx context.Context, b *Ban) error {
+	var expires any
+	if b.ExpiresAt != nil {
+		expires = b.ExpiresAt.UTC()
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO bans (prefix, reason, created_at, expires_at) VALUES (?, ?, ?, ?)`,
+		b.Prefix.String(), b.Reason, b.CreatedAt.UTC(), expires)
+	if err != nil {
+		return err
+	}
+	b.ID, err = res.LastInsertId()
+	return err
+}
+
+func (s *sqliteBanStore) Remove(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM bans WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrBanNotFound
+	}
+	return err
+}
+
+func (s *sqliteBanStore) List(ctx context.Context) ([]Ban, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, prefix, reason, created_at, expires_at FROM bans WHERE expires_at IS NULL OR expires_at > ? ORDER BY id`,
+		time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Ban
+	for rows.Next() {
+		var b Ban
+		var prefix string
+		var expires sql.NullTime
+		if err := rows.Scan(&b.ID, &prefix, &b.Reason, &b.CreatedAt, &expires); err != nil {
+			return nil, err
+		}
+		if b.Prefix, err = netip.ParsePrefix(prefix); err != nil {
+			return nil, err
+		}
+		if expires.Valid {
+			b.ExpiresAt = &expires.Time
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteBanStore) Close() error {
+	return s.db.Close()
+}
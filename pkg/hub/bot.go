@@ -0,0 +1,296 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Cat Companion ----------------------
+
+// With limits.BotAfter set, a client that has waited that long without a
+// match is kept company by a server-side cat until someone real turns up.
+// The client stays in the waiting pool throughout: the moment it is
+// matched, the cat says goodbye and the new partner takes over, and next
+// sends the cat away without leaving the pool. Replies come from a
+// Responder, the canned cat lines by default or a chat-completions model
+// with -bot-llm-url; bot messages carry From "bot" so clients can tell.
+
+// BotLine is a line of a conversation with the bot.
+type BotLine struct {
+	FromBot bool
+	Text    string
+}
+
+// Responder writes the bot's side of a conversation. Respond gets the
+// conversation so far, oldest first, and returns the bot's next line; with
+// no history yet that is its greeting. It runs on the bot's own goroutine,
+// so it may block until ctx is done, but it must be safe for concurrent
+// use.
+type Responder interface {
+	Respond(ctx context.Context, history []BotLine) (string, error)
+}
+
+// SetResponder makes r write the bot's replies, replacing the canned ones
+// or any model set by -bot-llm-url. It must be called before the hub
+// starts serving.
+func (h *Hub) SetResponder(r Responder) {
+	h.responder = r
+}
+
+// catBot is a client's bot companion. Its goroutine answers what the client
+// says until cancel is called.
+type catBot struct {
+	in     chan string
+	cancel context.CancelFunc
+	// sent numbers the client's messages to the bot for sent receipts. It
+	// is owned by the run loop.
+	sent uint64
+}
+
+// startBot gives c a bot companion if it is still waiting alone. It runs
+// on the run loop.
+func (h *Hub) startBot(c *Client) {
+	if !h.isWaiting(c) || c.bot != nil || c.suspended {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &catBot{in: make(chan string, h.limits.BotInbox), cancel: cancel}
+	c.bot = b
+	h.metrics.botSessions.Inc()
+	c.log.Info("bot companion started")
+	h.deliver(c, h.notice("bot_paired", client.CodeBotPaired, nil))
+	go h.runBot(ctx, c, b)
+}
+
+// endBot sends c's bot companion away, if it has one. It runs on the run
+// loop.
+func (h *Hub) endBot(c *Client) {
+	if c.bot == nil {
+		return
+	}
+	c.bot.cancel()
+	c.bot = nil
+}
+
+// handOff ends c's bot companion because c has been paired, telling c so.
+func (h *Hub) handOff(c *Client) {
+	if c.bot == nil {
+		return
+	}
+	h.endBot(c)
+	h.metrics.botHandoffs.Inc()
+	h.deliver(c, h.notice("bot_left", client.CodeBotHandoff, nil))
+}
+
+// tellBot hands text from c to its bot and confirms it like a relayed
+// message. It runs on the run loop.
+func (h *Hub) tellBot(c *Client, text string) {
+	b := c.bot
+	select {
+	case b.in <- text:
+	default:
+	}
+	b.sent++
+	sent := h.serverMessage("sent", "")
+	sent.ID = b.sent
+	h.deliver(c, sent)
+}
+
+// runBot greets c and then answers each line it sends, showing the cat
+// typing for a moment before every reply.
+func (h *Hub) runBot(ctx context.Context, c *Client, b *catBot) {
+	var history []BotLine
+	for {
+		reply := h.botReply(ctx, c, history)
+		if ctx.Err() != nil {
+			return
+		}
+		h.fromBot(c, b, client.Message{Type: "typing_start", From: client.FromBot, Text: "The cat is typing..."})
+		select {
+		case <-time.After(botTypingDelay(reply)):
+		case <-ctx.Done():
+			return
+		}
+		msg := h.serverMessage("message", reply)
+		msg.From = client.FromBot
+		h.fromBot(c, b, msg)
+		history = append(history, BotLine{FromBot: true, Text: reply})
+
+		select {
+		case text := <-b.in:
+			history = append(history, BotLine{Text: text})
+		case <-ctx.Done():
+			return
+		}
+		if n := h.limits.BotHistory; len(history) > n {
+			history = history[len(history)-n:]
+		}
+	}
+}
+
+// botReply asks the responder for the next line, falling back to a canned
+// one if it fails.
+func (h *Hub) botReply(ctx context.Context, c *Client, history []BotLine) string {
+	ctx, cancel := context.WithTimeout(ctx, h.limits.BotRespondTimeout)
+	defer cancel()
+	reply, err := h.responder.Respond(ctx, history)
+	if err != nil || strings.TrimSpace(reply) == "" {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			c.log.Error("bot responder", "err", err)
+		}
+		reply, _ = cannedResponder{}.Respond(ctx, history)
+	}
+	return truncateRunes(reply, h.limits.MaxMessageLength)
+}
+
+// fromBot delivers msg to c unless b has been sent away in the meantime.
+func (h *Hub) fromBot(c *Client, b *catBot, msg client.Message) {
+	h.do(func() {
+		if h.clients[c] && c.bot == b {
+			h.deliver(c, msg)
+		}
+	})
+}
+
+// botTypingDelay is how long the cat appears to type reply for.
+func botTypingDelay(reply string) time.Duration {
+	d := 600*time.Millisecond + time.Duration(utf8.RuneCountInString(reply))*40*time.Millisecond
+	return min(d, 3*time.Second)
+}
+
+// ---------------------- Canned Responder ----------------------
+
+// cannedResponder answers with stock cat lines, picking the kind by what
+// the client last said.
+type cannedResponder struct{}
+
+var (
+	catGreetings = []string{
+		"Meow! 🐱 Nobody else is around just yet, so I'll keep you company.",
+		"*stretches* Oh, hello! I'm the house cat. Chat with me while we find you someone.",
+		"Purr... a visitor! I'll sit with you until a real person shows up.",
+	}
+	catHellos = []string{
+		"Meow meow! 👋",
+		"*headbutts your hand* Hi!",
+		"Hello, human. You may pet me. Once.",
+	}
+	catAnswers = []string{
+		"Hmm, I'd have to think about that after my nap. 😴",
+		"The answer is almost always: more treats.",
+		"*tilts head* Mrrp?",
+		"I know, but I'm not telling. 😼",
+	}
+	catChatter = []string{
+		"Purrrr... 😺",
+		"*knocks something off the table*",
+		"Interesting. Tell me more while I groom my paw.",
+		"Mrow! That reminds me of the time I caught a sock.",
+		"*blinks slowly* That's cat for \"I like you\".",
+		"I'm listening. Mostly. There's a bird outside.",
+	}
+)
+
+func (cannedResponder) Respond(_ context.Context, history []BotLine) (string, error) {
+	if len(history) == 0 {
+		return pickLine(catGreetings), nil
+	}
+	last := strings.ToLower(history[len(history)-1].Text)
+	switch {
+	case strings.Contains(last, "?"):
+		return pickLine(catAnswers), nil
+	case strings.HasPrefix(last, "hi") || strings.HasPrefix(last, "hello") || strings.HasPrefix(last, "hey"):
+		return pickLine(catHellos), nil
+	}
+	return pickLine(catChatter), nil
+}
+
+func pickLine(lines []string) string {
+	return lines[rand.Intn(len(lines))]
+}
+
+// ---------------------- Model Responder ----------------------
+
+// botPersona is the system prompt for model-backed replies.
+const botPersona = "You are a friendly cat keeping a visitor to CatChat, an anonymous chat site, " +
+	"company while they wait for a human partner. Stay in character as a cat, keep replies to one " +
+	"or two short sentences, stay kind and safe for all ages, and never ask for personal details."
+
+// modelResponder writes replies with an OpenAI-style chat completions
+// endpoint, which most hosted and self-hosted model servers provide.
+type modelResponder struct {
+	url    string
+	model  string
+	key    string
+	client *http.Client
+}
+
+func newModelResponder(url, model, key string, timeout time.Duration) *modelResponder {
+	return &modelResponder{url: url, model: model, key: key, client: &http.Client{Timeout: timeout}}
+}
+
+type chatCompletionMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+func (m *modelResponder) Respond(ctx context.Context, history []BotLine) (string, error) {
+	messages := []chatCompletionMessage{{Role: "system", Content: botPersona}}
+	for _, l := range history {
+		role := "user"
+		if l.FromBot {
+			role = "assistant"
+		}
+		messages = append(messages, chatCompletionMessage{Role: role, Content: l.Text})
+	}
+	body, err := json.Marshal(map[string]any{"model": m.model, "messages": messages, "max_tokens": 120})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.key != "" {
+		req.Header.Set("Authorization", "Bearer "+m.key)
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("asking model: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("asking model: %s", resp.Status)
+	}
+	var result struct {
+		Choices []struct {
+			Message chatCompletionMessage `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("asking model: %w", err)
+	}
+	if len(result.Choices) == 0 {
+		return "", errors.New("asking model: no choices in answer")
+	}
+	return result.Choices[0].Message.Content, nil
+}
+
+// newResponder returns the responder cfg asks for.
+func newResponder(cfg Config) Responder {
+	if cfg.BotLLMURL != "" {
+		return newModelResponder(cfg.BotLLMURL, cfg.BotLLMModel, cfg.BotLLMKey, cfg.Limits.BotRespondTimeout)
+	}
+	return cannedResponder{}
+}
@@ -0,0 +1,140 @@
+package hub
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Bot Participants ----------------------
+
+// Programs embedding the hub can add automated participants, such as a
+// welcome bot, a survey or load generators, with AddBot. A bot is a Client
+// without a connection: it waits in the queues for its tags and is matched
+// with people like anyone else, and the hub's messages to it are turned
+// into BotEvents, handled in order on a goroutine of its own. When its
+// partner leaves, the bot goes back to waiting. Bots on one instance are
+// never matched with each other, and what they send skips the message
+// filters.
+//
+//	hub.AddBot("welcome", []string{"default"}, BotFunc(func(b *BotClient, ev BotEvent) {
+//		if ev.Type == BotPaired {
+//			b.Send("Welcome to CatChat! Say \"next\" to meet someone.")
+//		}
+//	}))
+
+// Bot event types.
+const (
+	// BotPaired is sent when the bot is paired, with the shared interests.
+	BotPaired = "paired"
+	// BotMessage carries a chat message from the bot's partner in Text.
+	BotMessage = "message"
+	// BotPartnerLeft is sent when the partner leaves; the bot is already
+	// waiting for the next one.
+	BotPartnerLeft = "partner_left"
+	// BotClosed is the last event, once the bot has been removed or the
+	// hub has shut down.
+	BotClosed = "closed"
+)
+
+// BotEvent is something that happened to a bot.
+type BotEvent struct {
+	Type      string
+	Text      string
+	Interests []string
+}
+
+// Bot handles the events of an automated participant. Handle runs on the
+// bot's own goroutine and should return quickly: events pile up behind it,
+// and a bot that falls Limits.BotSendBuffer messages behind is disconnected
+// as a slow consumer.
+type Bot interface {
+	Handle(b *BotClient, ev BotEvent)
+}
+
+// BotFunc adapts a function to a Bot.
+type BotFunc func(b *BotClient, ev BotEvent)
+
+func (f BotFunc) Handle(b *BotClient, ev BotEvent) { f(b, ev) }
+
+// BotClient is a bot's handle on the hub.
+type BotClient struct {
+	c   *Client
+	bot Bot
+}
+
+// AddBot registers b as a participant named name, waiting for partners
+// interested in tags, and returns its handle. The hub must be running.
+func (h *Hub) AddBot(name string, tags []string, b Bot) *BotClient {
+	connID := newConnID()
+	c := &Client{
+		id:        newSessionID(),
+		connID:    connID,
+		log:       slog.With("conn", connID, "bot", name),
+		hub:       h,
+		interests: parseInterests(strings.Join(tags, ","), h.limits.MaxInterests),
+		createdAt: time.Now(),
+		send:      make(chan client.Message, h.limits.BotSendBuffer),
+		automated: true,
+	}
+	bc := &BotClient{c: c, bot: b}
+	go bc.pump()
+	h.do(func() {
+		if h.stopped {
+			c.closeSend()
+			return
+		}
+		h.clients[c] = true
+		h.bots[c.id] = true
+		h.metrics.connections.Inc()
+		c.log.Info("bot registered", "interests", c.interests)
+		h.match(c)
+	})
+	return bc
+}
+
+// ID is the bot's session ID.
+func (b *BotClient) ID() string {
+	return b.c.id
+}
+
+// Send sends text to the bot's partner, if it has one.
+func (b *BotClient) Send(text string) {
+	text = truncateRunes(text, b.c.hub.limits.MaxMessageLength)
+	post(b.c.hub, b.c.hub.relay, relayRequest{from: b.c, msg: client.Message{Type: "message", Text: text}})
+}
+
+// Next leaves the bot's partner and waits for another.
+func (b *BotClient) Next() {
+	post(b.c.hub, b.c.hub.next, b.c)
+}
+
+// Close removes the bot from the hub.
+func (b *BotClient) Close() {
+	h := b.c.hub
+	h.do(func() {
+		b.c.closeReason = "bot removed"
+		h.remove(b.c)
+	})
+}
+
+// pump turns the messages the hub delivers to the bot into events.
+func (b *BotClient) pump() {
+	for msg := range b.c.send {
+		var ev BotEvent
+		switch {
+		case msg.Type == "paired":
+			ev = BotEvent{Type: BotPaired, Interests: msg.Interests}
+		case msg.Type == "message" && msg.From == client.FromPartner:
+			ev = BotEvent{Type: BotMessage, Text: msg.Text}
+		case msg.Type == "partner_left":
+			ev = BotEvent{Type: BotPartnerLeft}
+		default:
+			continue
+		}
+		b.bot.Handle(b, ev)
+	}
+	b.bot.Handle(b, BotEvent{Type: BotClosed})
+}
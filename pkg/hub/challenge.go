@@ -0,0 +1,203 @@
+package hub
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Challenges ----------------------
+
+// With a challenger configured, a new connection has to prove it isn't a
+// bot before it is matched, put in a room or allowed to invite anyone. The
+// server sends a challenge message right after the session one, and the
+// client answers with a challenge_response carrying its answer in Token.
+// A wrong answer gets a fresh challenge; a client that hasn't passed within
+// limits.ChallengeTimeout is disconnected. Resumed sessions are not
+// challenged again.
+//
+// The built-in challengers are hashcash-style proof of work and a CAPTCHA
+// token check against a siteverify endpoint, which hCaptcha, reCAPTCHA and
+// Turnstile all provide. Others can be plugged in with SetChallenger.
+
+// Challenger issues challenges and checks answers to them. Verify runs on
+// the client's read goroutine, so it may block, but it must be safe for
+// concurrent use.
+type Challenger interface {
+	Issue() client.Challenge
+	Verify(ctx context.Context, ch client.Challenge, answer string, ip netip.Addr) error
+}
+
+var errChallengeFailed = errors.New("wrong answer to challenge")
+
+// SetChallenger makes new connections solve ch before they are matched,
+// replacing any challenger set by -challenge. It must be called before the
+// hub starts serving.
+func (h *Hub) SetChallenger(ch Challenger) {
+	h.challenger = ch
+}
+
+// challenge sends c a new challenge and holds it back from matching until
+// it is answered. It runs on the run loop.
+func (h *Hub) challenge(c *Client) {
+	ch := h.challenger.Issue()
+	c.challenge = &ch
+	if c.challengeTimer == nil {
+		c.challengeTimer = time.AfterFunc(h.limits.ChallengeTimeout, func() {
+			h.do(func() { h.challengeExpired(c) })
+		})
+	}
+	msg := h.notice("challenge", client.CodeChallenge, nil)
+	msg.Challenge = &ch
+	h.deliver(c, msg)
+}
+
+// challengeExpired disconnects c if it still hasn't passed.
+func (h *Hub) challengeExpired(c *Client) {
+	if h.clients[c] && c.challenge != nil {
+		h.metrics.challenges.WithLabelValues("timeout").Inc()
+		h.kick(c, "challenge not solved in time", client.CodeKickedChallenge)
+	}
+}
+
+// answerChallenge checks c's answer to its current challenge on the read
+// goroutine, then lets c in or challenges it again.
+func (c *Client) answerChallenge(answer string) {
+	var ch *client.Challenge
+	c.hub.do(func() { ch = c.challenge })
+	if ch == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.hub.limits.ChallengeVerifyTimeout)
+	err := c.hub.challenger.Verify(ctx, *ch, answer, c.ip)
+	cancel()
+	if err != nil && !errors.Is(err, errChallengeFailed) {
+		c.log.Error("checking challenge", "err", err)
+	}
+	c.hub.do(func() {
+		// A second answer to the same challenge may have been checked in
+		// the meantime.
+		if !c.hub.clients[c] || c.challenge != ch {
+			return
+		}
+		if err != nil {
+			c.hub.metrics.challenges.WithLabelValues("failed").Inc()
+			c.hub.deliver(c, c.hub.notice("error", client.CodeChallengeFailed, nil))
+			c.hub.challenge(c)
+			return
+		}
+		c.hub.metrics.challenges.WithLabelValues("passed").Inc()
+		c.challenge = nil
+		c.challengeTimer.Stop()
+		c.hub.enter(c)
+	})
+}
+
+// ---------------------- Proof of Work ----------------------
+
+// powChallenger asks clients to find a partial SHA-256 preimage. A seed is
+// random per challenge, so answers can't be reused.
+type powChallenger struct {
+	bits int
+}
+
+func (p powChallenger) Issue() client.Challenge {
+	return client.Challenge{Kind: "pow", Seed: newSessionID() + newSessionID(), Bits: p.bits}
+}
+
+func (p powChallenger) Verify(_ context.Context, ch client.Challenge, answer string, _ netip.Addr) error {
+	if answer == "" || len(answer) > 64 {
+		return errChallengeFailed
+	}
+	sum := sha256.Sum256([]byte(ch.Seed + answer))
+	if leadingZeroBits(sum[:]) < ch.Bits {
+		return errChallengeFailed
+	}
+	return nil
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, x := range b {
+		if x != 0 {
+			return n + bits.LeadingZeros8(x)
+		}
+		n += 8
+	}
+	return n
+}
+
+// ---------------------- CAPTCHA ----------------------
+
+// captchaChallenger checks CAPTCHA response tokens with the provider's
+// siteverify endpoint.
+type captchaChallenger struct {
+	verifyURL string
+	siteKey   string
+	secret    string
+	client    *http.Client
+}
+
+func newCaptchaChallenger(verifyURL, siteKey, secret string, timeout time.Duration) *captchaChallenger {
+	return &captchaChallenger{
+		verifyURL: verifyURL,
+		siteKey:   siteKey,
+		secret:    secret,
+		client:    &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *captchaChallenger) Issue() client.Challenge {
+	return client.Challenge{Kind: "captcha", SiteKey: c.siteKey}
+}
+
+func (c *captchaChallenger) Verify(ctx context.Context, _ client.Challenge, answer string, ip netip.Addr) error {
+	if answer == "" {
+		return errChallengeFailed
+	}
+	form := url.Values{"secret": {c.secret}, "response": {answer}, "sitekey": {c.siteKey}}
+	if ip.IsValid() {
+		form.Set("remoteip", ip.String())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("verifying captcha: %w", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("verifying captcha: %w", err)
+	}
+	if !result.Success {
+		return errChallengeFailed
+	}
+	return nil
+}
+
+// newChallenger returns the challenger cfg asks for, or nil for none.
+func newChallenger(cfg Config) Challenger {
+	switch cfg.Challenge {
+	case "pow":
+		return powChallenger{bits: cfg.Limits.ChallengeBits}
+	case "captcha":
+		return newCaptchaChallenger(cfg.CaptchaVerifyURL, cfg.CaptchaSiteKey, cfg.CaptchaSecret, cfg.Limits.ChallengeVerifyTimeout)
+	}
+	return nil
+}
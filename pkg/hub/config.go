@@ -0,0 +1,407 @@
+package hub
+
+import (
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/filter"
+)
+
+// ---------------------- Config ----------------------
+
+// Config holds the operator-facing settings. Every field can be set with a
+// command-line flag or a CATCHAT_* environment variable; flags win.
+type Config struct {
+	Addr string
+	// StaticDir is served instead of the embedded frontend if set.
+	StaticDir string
+	// LogFormat is "text" or "json", and LogLevel the least severe level
+	// logged: "debug", "info", "warn" or "error".
+	LogFormat string
+	LogLevel  string
+	// Mode is "production" or "development". Development relaxes checks
+	// meant for public deployments, such as admitting any origin when
+	// AllowedOrigins is empty.
+	Mode string
+	// AllowedOrigins are the origins WebSocket handshakes may come from;
+	// see origin.go for the syntax.
+	AllowedOrigins []string
+	WordListPath   string
+	// WordListPoll is how often WordListPath is checked for changes; 0
+	// disables reloading except through the admin API.
+	WordListPoll time.Duration
+	// LocalesDir holds extra <lang>.json notice catalogs, added to or
+	// overriding the built-in ones.
+	LocalesDir string
+	// ReportsDB is the SQLite file reports are stored in; empty keeps them
+	// in memory only.
+	ReportsDB string
+	// BansDB is the SQLite file bans are stored in; empty keeps them in
+	// memory only.
+	BansDB string
+	// AdminToken is the bearer token for /admin; empty disables it.
+	AdminToken string
+	// Hub is "memory" for a single instance or "redis" to share the waiting
+	// pool and relay messages between instances through RedisAddr.
+	Hub       string
+	RedisAddr string
+	// SessionSecret signs the tokens clients resume sessions with. Empty
+	// picks a random one, so tokens don't survive a restart.
+	SessionSecret string
+	// LinkMode is what happens to chat messages with links to hosts outside
+	// LinkAllowlist: "allow", "strip", "censor" or "block"; see filter.go.
+	LinkMode      string
+	LinkAllowlist []string
+	// Challenge is what new connections must solve before they are
+	// matched: "none", "pow" or "captcha"; see challenge.go. Captcha
+	// challenges are checked against CaptchaVerifyURL with CaptchaSecret.
+	Challenge        string
+	CaptchaVerifyURL string
+	CaptchaSiteKey   string
+	CaptchaSecret    string
+	// OTLPEndpoint is the OTLP/HTTP collector spans are exported to, empty
+	// to disable tracing, and TraceSampleRatio the share of traces kept.
+	OTLPEndpoint     string
+	TraceSampleRatio float64
+	// WebhookURLs receive the WebhookEvents, or every event if that is
+	// empty, signed with WebhookSecret; see webhook.go.
+	WebhookURLs   []string
+	WebhookSecret string
+	WebhookEvents []string
+	// BotLLMURL is the chat completions endpoint bot companions reply
+	// with, called with BotLLMModel and BotLLMKey; empty uses the canned
+	// replies. See bot.go.
+	BotLLMURL   string
+	BotLLMModel string
+	BotLLMKey   string
+	// MediaTypes are the MIME types clients may share, which must be
+	// raster image types.
+	MediaTypes []string
+	// MaxConnections caps concurrent WebSocket connections, and
+	// MaxConnectionsPerIP those from one address; 0 means no cap.
+	MaxConnections      int
+	MaxConnectionsPerIP int
+	// Compression negotiates permessage-deflate with clients that offer
+	// it, trading server CPU for smaller frames.
+	Compression bool
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For header
+	// is used to find a client's address.
+	TrustedProxies []netip.Prefix
+	Limits         Limits
+}
+
+// LoadConfig parses args (without the program name) on top of the
+// environment and the built-in defaults.
+func LoadConfig(args []string) (Config, error) {
+	cfg := Config{Limits: DefaultLimits()}
+	fs := flag.NewFlagSet("catchat", flag.ContinueOnError)
+
+	var origins, mediaTypes, proxies, linkAllowlist, webhookURLs, events string
+	fs.StringVar(&cfg.Addr, "addr", envString("CATCHAT_ADDR", ":8080"), "listen address")
+	fs.StringVar(&cfg.StaticDir, "static", envString("CATCHAT_STATIC_DIR", ""), "directory to serve the frontend from instead of the copy built into the binary, e.g. ./pkg/hub/static while working on it")
+	fs.StringVar(&cfg.LogFormat, "log-format", envString("CATCHAT_LOG_FORMAT", "text"), `log format: "text" or "json"`)
+	fs.StringVar(&cfg.LogLevel, "log-level", envString("CATCHAT_LOG_LEVEL", "info"), `least severe level logged: "debug", "info", "warn" or "error"`)
+	fs.StringVar(&cfg.Mode, "mode", envString("CATCHAT_MODE", "production"), `"production" or "development"`)
+	fs.StringVar(&origins, "origins", envString("CATCHAT_ALLOWED_ORIGINS", ""), "comma-separated allowed WebSocket origins, e.g. https://*.example.com (empty allows the same origin, or any in development mode)")
+	fs.StringVar(&cfg.LocalesDir, "locales", envString("CATCHAT_LOCALES", ""), "directory of extra <lang>.json notice catalogs")
+	fs.StringVar(&cfg.ReportsDB, "reports-db", envString("CATCHAT_REPORTS_DB", ""), "SQLite file for user reports (empty keeps them in memory)")
+	fs.StringVar(&cfg.BansDB, "bans-db", envString("CATCHAT_BANS_DB", ""), "SQLite file for IP bans (empty keeps them in memory)")
+	fs.StringVar(&cfg.AdminToken, "admin-token", envString("CATCHAT_ADMIN_TOKEN", ""), "bearer token for the /admin API (empty disables it)")
+	fs.StringVar(&cfg.Hub, "hub", envString("CATCHAT_HUB", "memory"), `hub backend: "memory" or "redis"`)
+	fs.StringVar(&cfg.RedisAddr, "redis-addr", envString("CATCHAT_REDIS_ADDR", "localhost:6379"), "Redis address for the redis hub backend")
+	fs.StringVar(&cfg.SessionSecret, "session-secret", envString("CATCHAT_SESSION_SECRET", ""), "secret for signing session resume tokens (empty picks a random one)")
+	fs.StringVar(&proxies, "trusted-proxies", envString("CATCHAT_TRUSTED_PROXIES", ""), "comma-separated proxy addresses or CIDR ranges whose X-Forwarded-For is trusted")
+	fs.StringVar(&mediaTypes, "media-types", envString("CATCHAT_MEDIA_TYPES", "image/png,image/jpeg,image/gif,image/webp"), "comma-separated MIME types clients may share")
+	fs.StringVar(&cfg.LinkMode, "links", envString("CATCHAT_LINKS", filter.LinksCensor), `what to do with links in chat messages: "allow", "strip", "censor" or "block"`)
+	fs.StringVar(&linkAllowlist, "link-allowlist", envString("CATCHAT_LINK_ALLOWLIST", ""), "comma-separated domains whose links, and their subdomains', are always allowed")
+	fs.StringVar(&cfg.Challenge, "challenge", envString("CATCHAT_CHALLENGE", "none"), `challenge new connections must pass before they are matched: "none", "pow" or "captcha"`)
+	fs.StringVar(&cfg.CaptchaVerifyURL, "captcha-verify-url", envString("CATCHAT_CAPTCHA_VERIFY_URL", ""), "siteverify endpoint CAPTCHA tokens are checked against, e.g. https://api.hcaptcha.com/siteverify")
+	fs.StringVar(&cfg.CaptchaSiteKey, "captcha-site-key", envString("CATCHAT_CAPTCHA_SITE_KEY", ""), "CAPTCHA site key sent to clients")
+	fs.StringVar(&cfg.CaptchaSecret, "captcha-secret", envString("CATCHAT_CAPTCHA_SECRET", ""), "CAPTCHA secret key for the siteverify endpoint")
+	fs.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", envString("CATCHAT_OTLP_ENDPOINT", ""), "OTLP/HTTP collector URL to export traces to, e.g. http://localhost:4318 (empty disables tracing)")
+	fs.StringVar(&webhookURLs, "webhooks", envString("CATCHAT_WEBHOOKS", ""), "comma-separated URLs to POST server events to")
+	fs.StringVar(&cfg.WebhookSecret, "webhook-secret", envString("CATCHAT_WEBHOOK_SECRET", ""), "secret webhook requests are signed with (empty sends them unsigned)")
+	fs.StringVar(&events, "webhook-events", envString("CATCHAT_WEBHOOK_EVENTS", ""), "comma-separated events to send to webhooks (empty sends all): "+strings.Join(webhookEvents, ", "))
+	fs.StringVar(&cfg.BotLLMURL, "bot-llm-url", envString("CATCHAT_BOT_LLM_URL", ""), "OpenAI-style chat completions URL the bot companion replies with, e.g. http://localhost:11434/v1/chat/completions (empty uses canned replies)")
+	fs.StringVar(&cfg.BotLLMModel, "bot-llm-model", envString("CATCHAT_BOT_LLM_MODEL", ""), "model the bot companion asks for")
+	fs.StringVar(&cfg.BotLLMKey, "bot-llm-key", envString("CATCHAT_BOT_LLM_KEY", ""), "API key for -bot-llm-url")
+	fs.StringVar(&cfg.WordListPath, "wordlist", envString("CATCHAT_WORDLIST", ""), "profanity word list file, one word and optional severity per line (empty uses the built-in list)")
+
+	var err error
+	intFlag := func(p *int, name, env string, def int, usage string) {
+		v, e := envInt(env, def)
+		if e != nil {
+			err = errors.Join(err, e)
+		}
+		fs.IntVar(p, name, v, usage)
+	}
+	intFlag(&cfg.MaxConnections, "max-connections", "CATCHAT_MAX_CONNECTIONS", 0, "maximum concurrent connections (0 for no limit)")
+	intFlag(&cfg.MaxConnectionsPerIP, "max-connections-per-ip", "CATCHAT_MAX_CONNECTIONS_PER_IP", 8, "maximum concurrent connections from one address (0 for no limit)")
+	intFlag(&cfg.Limits.ReadBufferSize, "read-buffer", "CATCHAT_READ_BUFFER", cfg.Limits.ReadBufferSize, "WebSocket read buffer size in bytes")
+	intFlag(&cfg.Limits.WriteBufferSize, "write-buffer", "CATCHAT_WRITE_BUFFER", cfg.Limits.WriteBufferSize, "WebSocket write buffer size in bytes")
+	intFlag(&cfg.Limits.SendBuffer, "send-buffer", "CATCHAT_SEND_BUFFER", cfg.Limits.SendBuffer, "queued outbound messages per client")
+	intFlag(&cfg.Limits.SendHighWater, "send-high-water", "CATCHAT_SEND_HIGH_WATER", cfg.Limits.SendHighWater, "queued messages past which typing notifications are dropped")
+	intFlag(&cfg.Limits.StrikeLimit, "strike-limit", "CATCHAT_STRIKE_LIMIT", cfg.Limits.StrikeLimit, "strikes within -strike-window that ban an address")
+	intFlag(&cfg.Limits.ChallengeBits, "challenge-bits", "CATCHAT_CHALLENGE_BITS", cfg.Limits.ChallengeBits, "proof-of-work difficulty in leading zero bits")
+	intFlag(&cfg.Limits.MaxMediaBytes, "max-media-bytes", "CATCHAT_MAX_MEDIA_BYTES", cfg.Limits.MaxMediaBytes, "maximum size of an uploaded file in bytes")
+	intFlag(&cfg.Limits.MaxMessageLength, "max-message-length", "CATCHAT_MAX_MESSAGE_LENGTH", cfg.Limits.MaxMessageLength, "maximum characters in a chat message")
+	intFlag(&cfg.Limits.MaxFrameBytes, "max-frame-bytes", "CATCHAT_MAX_FRAME_BYTES", cfg.Limits.MaxFrameBytes, "maximum size of a WebSocket frame from a client")
+	intFlag(&cfg.Limits.MaxInlineMediaBytes, "max-inline-media-bytes", "CATCHAT_MAX_INLINE_MEDIA_BYTES", cfg.Limits.MaxInlineMediaBytes, "maximum size of a file sent inline in a media message")
+	intFlag(&cfg.Limits.MediaSessionBytes, "media-session-bytes", "CATCHAT_MEDIA_SESSION_BYTES", cfg.Limits.MediaSessionBytes, "maximum bytes of uploads held for one session")
+	intFlag(&cfg.Limits.MediaStoreBytes, "media-store-bytes", "CATCHAT_MEDIA_STORE_BYTES", cfg.Limits.MediaStoreBytes, "maximum bytes of uploads held in all")
+	intFlag(&cfg.Limits.LowRatingCount, "low-rating-count", "CATCHAT_LOW_RATING_COUNT", cfg.Limits.LowRatingCount, "ratings an address needs before a low average de-prioritizes it")
+	intFlag(&cfg.Limits.MaxRoomSize, "max-room-size", "CATCHAT_MAX_ROOM_SIZE", cfg.Limits.MaxRoomSize, "maximum members of a group room")
+	intFlag(&cfg.Limits.MessageBurst, "message-burst", "CATCHAT_MESSAGE_BURST", cfg.Limits.MessageBurst, "chat messages a client may send in a burst")
+	intFlag(&cfg.Limits.FloodRepeats, "flood-repeats", "CATCHAT_FLOOD_REPEATS", cfg.Limits.FloodRepeats, "identical messages in a row that count as flooding")
+	intFlag(&cfg.Limits.FloodMaxLines, "flood-max-lines", "CATCHAT_FLOOD_MAX_LINES", cfg.Limits.FloodMaxLines, "lines in one message beyond which it counts as flooding")
+	intFlag(&cfg.Limits.FloodBurst, "flood-burst", "CATCHAT_FLOOD_BURST", cfg.Limits.FloodBurst, "messages within the flood window beyond which a client is flooding")
+	intFlag(&cfg.Limits.RequeueBurst, "requeue-burst", "CATCHAT_REQUEUE_BURST", cfg.Limits.RequeueBurst, "partner changes a client may make in a burst")
+	intFlag(&cfg.Limits.TypingBurst, "typing-burst", "CATCHAT_TYPING_BURST", cfg.Limits.TypingBurst, "typing notifications a client may send in a burst")
+	intFlag(&cfg.Limits.WebhookAttempts, "webhook-attempts", "CATCHAT_WEBHOOK_ATTEMPTS", cfg.Limits.WebhookAttempts, "times a webhook request is made before its event is dropped")
+	boolFlag := func(p *bool, name, env string, def bool, usage string) {
+		v, e := envBool(env, def)
+		if e != nil {
+			err = errors.Join(err, e)
+		}
+		fs.BoolVar(p, name, v, usage)
+	}
+	boolFlag(&cfg.Compression, "compression", "CATCHAT_COMPRESSION", false, "compress WebSocket frames for clients that support it")
+	floatFlag := func(p *float64, name, env string, def float64, usage string) {
+		v, e := envFloat(env, def)
+		if e != nil {
+			err = errors.Join(err, e)
+		}
+		fs.Float64Var(p, name, v, usage)
+	}
+	floatFlag(&cfg.TraceSampleRatio, "trace-sample-ratio", "CATCHAT_TRACE_SAMPLE_RATIO", 1, "share of traces to sample, from 0 to 1")
+	floatFlag(&cfg.Limits.MessageRate, "message-rate", "CATCHAT_MESSAGE_RATE", cfg.Limits.MessageRate, "chat messages per second a client may sustain")
+	floatFlag(&cfg.Limits.RequeueRate, "requeue-rate", "CATCHAT_REQUEUE_RATE", cfg.Limits.RequeueRate, "partner changes per second a client may sustain")
+	floatFlag(&cfg.Limits.LowRatingScore, "low-rating-score", "CATCHAT_LOW_RATING_SCORE", cfg.Limits.LowRatingScore, "average rating at or below which an address is matched last")
+	floatFlag(&cfg.Limits.TypingRate, "typing-rate", "CATCHAT_TYPING_RATE", cfg.Limits.TypingRate, "typing notifications per second a client may sustain")
+	durationFlag := func(p *time.Duration, name, env string, def time.Duration, usage string) {
+		v, e := envDuration(env, def)
+		if e != nil {
+			err = errors.Join(err, e)
+		}
+		fs.DurationVar(p, name, v, usage)
+	}
+	durationFlag(&cfg.Limits.AnyTagAfter, "fallback-after", "CATCHAT_FALLBACK_AFTER", cfg.Limits.AnyTagAfter, "how long to wait for a shared interest before matching with anyone")
+	durationFlag(&cfg.Limits.BotAfter, "bot-after", "CATCHAT_BOT_AFTER", cfg.Limits.BotAfter, "how long a client waits alone before a cat bot keeps it company (0 disables)")
+	durationFlag(&cfg.Limits.InviteTTL, "invite-ttl", "CATCHAT_INVITE_TTL", cfg.Limits.InviteTTL, "how long an invite code can be used for")
+	durationFlag(&cfg.Limits.ResumeGrace, "resume-grace", "CATCHAT_RESUME_GRACE", cfg.Limits.ResumeGrace, "how long a dropped client may take to reconnect to its chat (0 disables)")
+	durationFlag(&cfg.Limits.IdleTimeout, "idle-timeout", "CATCHAT_IDLE_TIMEOUT", cfg.Limits.IdleTimeout, "how long a client may send nothing before it is disconnected (0 disables)")
+	durationFlag(&cfg.Limits.IdleWarning, "idle-warning", "CATCHAT_IDLE_WARNING", cfg.Limits.IdleWarning, "how long before the idle timeout a client is warned")
+	durationFlag(&cfg.Limits.MaxSession, "max-session", "CATCHAT_MAX_SESSION", cfg.Limits.MaxSession, "longest a session may last, resumes included (0 disables)")
+	durationFlag(&cfg.Limits.StrikeWindow, "strike-window", "CATCHAT_STRIKE_WINDOW", cfg.Limits.StrikeWindow, "window in which strikes are counted")
+	durationFlag(&cfg.Limits.FloodWindow, "flood-window", "CATCHAT_FLOOD_WINDOW", cfg.Limits.FloodWindow, "window for counting a burst of messages as flooding")
+	durationFlag(&cfg.Limits.FloodMute, "flood-mute", "CATCHAT_FLOOD_MUTE", cfg.Limits.FloodMute, "how long a second flooding offence mutes a client for")
+	durationFlag(&cfg.Limits.FloodForget, "flood-forget", "CATCHAT_FLOOD_FORGET", cfg.Limits.FloodForget, "how long until a client's flooding offences are forgotten")
+	durationFlag(&cfg.Limits.NextCooldown, "next-cooldown", "CATCHAT_NEXT_COOLDOWN", cfg.Limits.NextCooldown, "least time between two partner changes by one client")
+	durationFlag(&cfg.Limits.TypingThrottle, "typing-throttle", "CATCHAT_TYPING_THROTTLE", cfg.Limits.TypingThrottle, "least time between relayed typing indicators from one client")
+	durationFlag(&cfg.Limits.TypingTimeout, "typing-timeout", "CATCHAT_TYPING_TIMEOUT", cfg.Limits.TypingTimeout, "how long a typing indicator lasts without a stop")
+	durationFlag(&cfg.Limits.StrikeBan, "strike-ban", "CATCHAT_STRIKE_BAN", cfg.Limits.StrikeBan, "how long too many strikes ban an address for")
+	durationFlag(&cfg.Limits.RatingWindow, "rating-window", "CATCHAT_RATING_WINDOW", cfg.Limits.RatingWindow, "how long ratings count against an address")
+	durationFlag(&cfg.Limits.LowRatingPenalty, "low-rating-penalty", "CATCHAT_LOW_RATING_PENALTY", cfg.Limits.LowRatingPenalty, "extra wait before a low-rated address is matched")
+	durationFlag(&cfg.Limits.StatsInterval, "stats-interval", "CATCHAT_STATS_INTERVAL", cfg.Limits.StatsInterval, "how often to send clients presence stats (0 only on request)")
+	durationFlag(&cfg.Limits.BackendTimeout, "backend-timeout", "CATCHAT_BACKEND_TIMEOUT", cfg.Limits.BackendTimeout, "longest a call to the matchmaking backend may take")
+	durationFlag(&cfg.Limits.BotRespondTimeout, "bot-respond-timeout", "CATCHAT_BOT_RESPOND_TIMEOUT", cfg.Limits.BotRespondTimeout, "longest a cat bot may take to reply")
+	durationFlag(&cfg.Limits.ChallengeVerifyTimeout, "challenge-verify-timeout", "CATCHAT_CHALLENGE_VERIFY_TIMEOUT", cfg.Limits.ChallengeVerifyTimeout, "longest checking a challenge answer may take")
+	durationFlag(&cfg.Limits.WebhookTimeout, "webhook-timeout", "CATCHAT_WEBHOOK_TIMEOUT", cfg.Limits.WebhookTimeout, "longest a single webhook request may take")
+	durationFlag(&cfg.Limits.ChallengeTimeout, "challenge-timeout", "CATCHAT_CHALLENGE_TIMEOUT", cfg.Limits.ChallengeTimeout, "how long a new connection has to pass its challenge")
+	durationFlag(&cfg.Limits.MediaTTL, "media-ttl", "CATCHAT_MEDIA_TTL", cfg.Limits.MediaTTL, "how long uploaded files stay available")
+	durationFlag(&cfg.WordListPoll, "wordlist-poll", "CATCHAT_WORDLIST_POLL", 10*time.Second, "how often to check the word list file for changes (0 disables)")
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	cfg.AllowedOrigins = splitList(origins)
+	cfg.MediaTypes = splitList(mediaTypes)
+	cfg.LinkAllowlist = splitList(linkAllowlist)
+	cfg.WebhookURLs = splitList(webhookURLs)
+	cfg.WebhookEvents = splitList(events)
+	for _, s := range splitList(proxies) {
+		p, e := parseBanTarget(s)
+		if e != nil {
+			return cfg, fmt.Errorf("trusted-proxies: %w", e)
+		}
+		cfg.TrustedProxies = append(cfg.TrustedProxies, p)
+	}
+	return cfg, cfg.Validate()
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	if c.Addr == "" {
+		errs = append(errs, errors.New("addr must not be empty"))
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		errs = append(errs, fmt.Errorf(`log-format must be "text" or "json", got %q`, c.LogFormat))
+	}
+	if _, err := parseLogLevel(c.LogLevel); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Mode != "production" && c.Mode != "development" {
+		errs = append(errs, fmt.Errorf(`mode must be "production" or "development", got %q`, c.Mode))
+	}
+	for _, o := range c.AllowedOrigins {
+		if o == "*" {
+			continue
+		}
+		if _, err := parseOriginPattern(o); err != nil {
+			errs = append(errs, fmt.Errorf("origins: %w", err))
+		}
+	}
+	if _, err := filter.NewLinkPolicy(c.LinkMode, c.LinkAllowlist); err != nil {
+		errs = append(errs, err)
+	}
+	switch c.Challenge {
+	case "none", "pow":
+	case "captcha":
+		if c.CaptchaVerifyURL == "" || c.CaptchaSiteKey == "" || c.CaptchaSecret == "" {
+			errs = append(errs, errors.New("challenge captcha needs captcha-verify-url, captcha-site-key and captcha-secret"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf(`challenge must be "none", "pow" or "captcha", got %q`, c.Challenge))
+	}
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("trace-sample-ratio must be between 0 and 1, got %g", c.TraceSampleRatio))
+	}
+	if c.OTLPEndpoint != "" {
+		if u, err := url.Parse(c.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("otlp-endpoint must be an http or https URL, got %q", c.OTLPEndpoint))
+		}
+	}
+	if c.BotLLMURL != "" {
+		if u, err := url.Parse(c.BotLLMURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("bot-llm-url must be an http or https URL, got %q", c.BotLLMURL))
+		}
+		if c.BotLLMModel == "" {
+			errs = append(errs, errors.New("bot-llm-url needs bot-llm-model"))
+		}
+	}
+	for _, w := range c.WebhookURLs {
+		if u, err := url.Parse(w); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("webhooks: %q is not an http or https URL", w))
+		}
+	}
+	for _, t := range c.MediaTypes {
+		if !rasterImage(t) {
+			errs = append(errs, fmt.Errorf("media-types: %q is not a raster image type, so uploads of it could run script on this origin", t))
+		}
+	}
+	for _, e := range c.WebhookEvents {
+		if !slices.Contains(webhookEvents, e) {
+			errs = append(errs, fmt.Errorf("webhook-events: unknown event %q", e))
+		}
+	}
+	if c.Hub != "memory" && c.Hub != "redis" {
+		errs = append(errs, fmt.Errorf(`hub must be "memory" or "redis", got %q`, c.Hub))
+	}
+	if c.WordListPoll < 0 {
+		errs = append(errs, fmt.Errorf("wordlist-poll must not be negative, got %s", c.WordListPoll))
+	}
+	if c.MaxConnections < 0 {
+		errs = append(errs, fmt.Errorf("max-connections must not be negative, got %d", c.MaxConnections))
+	}
+	if c.MaxConnectionsPerIP < 0 {
+		errs = append(errs, fmt.Errorf("max-connections-per-ip must not be negative, got %d", c.MaxConnectionsPerIP))
+	}
+	if c.StaticDir != "" {
+		if info, err := os.Stat(c.StaticDir); err != nil || !info.IsDir() {
+			errs = append(errs, fmt.Errorf("static directory %q is not readable", c.StaticDir))
+		}
+	}
+	if err := c.Limits.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// SessionKey returns the key session tokens are signed with.
+func (c Config) SessionKey() []byte {
+	if c.SessionSecret != "" {
+		return []byte(c.SessionSecret)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func envString(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+func envInt(key string, def int) (int, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def, fmt.Errorf("%s: %w", key, err)
+	}
+	return n, nil
+}
+
+func envBool(key string, def bool) (bool, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return def, fmt.Errorf("%s: %w", key, err)
+	}
+	return b, nil
+}
+
+func envFloat(key string, def float64) (float64, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return def, fmt.Errorf("%s: %w", key, err)
+	}
+	return f, nil
+}
+
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return def, fmt.Errorf("%s: %w", key, err)
+	}
+	return d, nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
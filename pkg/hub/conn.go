@@ -0,0 +1,63 @@
+package hub
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ---------------------- Connections ----------------------
+
+// Conn is the part of a WebSocket connection a client's pumps use.
+// *websocket.Conn implements it, and hubtest.Conn is an in-memory one for
+// driving a hub without sockets. As with gorilla's, one goroutine may read
+// and one write at a time, and Close may be called from either.
+type Conn interface {
+	ReadMessage() (messageType int, data []byte, err error)
+	NextWriter(messageType int) (io.WriteCloser, error)
+	WriteMessage(messageType int, data []byte) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetReadLimit(limit int64)
+	SetPongHandler(h func(appData string) error)
+	Close() error
+}
+
+var _ Conn = (*websocket.Conn)(nil)
+
+// countingHijacker hands the upgrader a socket that counts the bytes
+// written to it in n, so frames can be measured as sent rather than as
+// encoded.
+type countingHijacker struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (h countingHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := h.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return countingConn{conn, h.n}, brw, nil
+}
+
+type countingConn struct {
+	net.Conn
+	n *atomic.Int64
+}
+
+func (c countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,92 @@
+package hub
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+	"github.com/Azeem01nnie/CatChat/pkg/filter"
+	"github.com/Azeem01nnie/CatChat/pkg/profanity"
+)
+
+// ---------------------- Message Filters ----------------------
+
+// Chat text goes through a chain of filters before it is relayed: the
+// built-in length, flood, profanity and link filters, then any added with
+// AddMessageFilter, in order.
+
+// AddMessageFilter appends f to the filter chain. It must be called before
+// the hub starts serving.
+func (h *Hub) AddMessageFilter(f filter.Filter) {
+	h.filters = append(h.filters, f)
+}
+
+// filterMessage runs text from c through the filter chain, returning the
+// text to relay and the verdict.
+func (h *Hub) filterMessage(c *Client, text string) (string, filter.Result) {
+	m := &filter.Message{Text: text, Sender: c.id, IP: c.ip}
+	chain := append([]filter.Filter{
+		filter.Func(h.filterLength),
+		filter.Func(func(m *filter.Message) filter.Result { return h.filterFlood(c, m) }),
+		filter.Func(h.filterProfanity),
+		filter.Func(h.filterLinks),
+	}, h.filters...)
+	out := filter.Run(chain, m)
+	if out.Code == "" {
+		switch out.Verdict {
+		case filter.Flag:
+			out.Code = client.CodeMessageFlagged
+		case filter.Reject:
+			out.Code = client.CodeMessageRejected
+		case filter.Kick:
+			out.Code = client.CodeKickedFilter
+		}
+	}
+	if out.Verdict == filter.Kick && out.Reason == "" {
+		out.Reason = "rejected by message filter"
+	}
+	return m.Text, out
+}
+
+// filterLength rejects messages over limits.MaxMessageLength runes.
+func (h *Hub) filterLength(m *filter.Message) filter.Result {
+	if max := h.limits.MaxMessageLength; utf8.RuneCountInString(m.Text) > max {
+		return filter.Result{Verdict: filter.Reject, Code: client.CodeMessageTooLong, Data: map[string]string{"max": strconv.Itoa(max)}}
+	}
+	return filter.Result{}
+}
+
+// filterProfanity masks blocked words, and flags or kicks according to
+// the most severe one.
+func (h *Hub) filterProfanity(m *filter.Message) filter.Result {
+	res := h.words.Filter().MaskString(m.Text)
+	h.metrics.profanityHits.Add(float64(res.Hits))
+	m.Text = res.Text
+	if res.Hits == 0 {
+		return filter.Result{}
+	}
+	switch res.Severity {
+	case profanity.Warn:
+		return filter.Result{Verdict: filter.Flag, Code: client.CodeLanguageWarning}
+	case profanity.Disconnect:
+		return filter.Result{Verdict: filter.Kick, Code: client.CodeKickedLanguage, Reason: "blocked language", Strike: true}
+	}
+	return filter.Result{}
+}
+
+// filterLinks strips, censors or rejects links to hosts that aren't
+// allowlisted. Stripping or censoring flags the message; one left empty by
+// stripping is rejected instead.
+func (h *Hub) filterLinks(m *filter.Message) filter.Result {
+	text, found := h.links.Rewrite(m.Text)
+	if !found {
+		return filter.Result{}
+	}
+	h.metrics.linksFiltered.WithLabelValues(h.links.Mode()).Inc()
+	if h.links.Mode() == filter.LinksBlock || strings.TrimSpace(text) == "" {
+		return filter.Result{Verdict: filter.Reject, Code: client.CodeLinkBlocked}
+	}
+	m.Text = text
+	return filter.Result{Verdict: filter.Flag, Code: client.CodeLinkRemoved}
+}
@@ -0,0 +1,130 @@
+package hub
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+	"github.com/Azeem01nnie/CatChat/pkg/filter"
+)
+
+// ---------------------- Flood Detection ----------------------
+
+// Separately from the rate limits, the flood filter watches each client's
+// chat messages for flooding: the same message sent limits.FloodRepeats
+// times in a row, a message of more than limits.FloodMaxLines lines, or
+// more than limits.FloodBurst messages within limits.FloodWindow. The
+// first time a client floods it is warned, the second time its messages
+// are dropped for limits.FloodMute, and the third time it is
+// disconnected. Offences are forgotten after limits.FloodForget without
+// another.
+
+type floodAction int
+
+const (
+	floodOK floodAction = iota
+	floodWarn
+	floodMute
+	floodKick
+	// floodMuted is a message sent while muted.
+	floodMuted
+)
+
+// floodDetector belongs to a single client's readPump and is not safe for
+// concurrent use.
+type floodDetector struct {
+	limits Limits
+
+	lastText string
+	repeats  int
+	recent   []time.Time
+
+	offences    int
+	lastOffence time.Time
+	mutedUntil  time.Time
+}
+
+func newFloodDetector(limits Limits) *floodDetector {
+	return &floodDetector{limits: limits}
+}
+
+// check looks at a message the client sent at now, returning what to do
+// about it and, for a new offence, which pattern it matched.
+func (f *floodDetector) check(text string, now time.Time) (floodAction, string) {
+	if now.Before(f.mutedUntil) {
+		return floodMuted, ""
+	}
+	pattern := f.detect(text, now)
+	if pattern == "" {
+		return floodOK, ""
+	}
+	if now.Sub(f.lastOffence) > f.limits.FloodForget {
+		f.offences = 0
+	}
+	f.offences++
+	f.lastOffence = now
+	switch f.offences {
+	case 1:
+		return floodWarn, pattern
+	case 2:
+		f.mutedUntil = now.Add(f.limits.FloodMute)
+		return floodMute, pattern
+	}
+	return floodKick, pattern
+}
+
+// detect returns the flood pattern text matches, if any, resetting that
+// pattern's count so one flood is only counted once.
+func (f *floodDetector) detect(text string, now time.Time) string {
+	text = strings.TrimSpace(text)
+	if strings.EqualFold(text, f.lastText) {
+		f.repeats++
+	} else {
+		f.lastText, f.repeats = text, 1
+	}
+	recent := f.recent[:0]
+	for _, at := range f.recent {
+		if now.Sub(at) < f.limits.FloodWindow {
+			recent = append(recent, at)
+		}
+	}
+	f.recent = append(recent, now)
+
+	switch {
+	case f.repeats >= f.limits.FloodRepeats:
+		f.repeats = 0
+		return "repeat"
+	case strings.Count(text, "\n")+1 > f.limits.FloodMaxLines:
+		return "lines"
+	case len(f.recent) > f.limits.FloodBurst:
+		f.recent = f.recent[:0]
+		return "burst"
+	}
+	return ""
+}
+
+// filterFlood is the flood filter: it flags a client's first offence,
+// rejects its messages while it is muted and kicks it on the third.
+func (h *Hub) filterFlood(c *Client, m *filter.Message) filter.Result {
+	action, pattern := c.flood.check(m.Text, time.Now())
+	if pattern != "" {
+		h.metrics.floodDetections.WithLabelValues(pattern).Inc()
+	}
+	switch action {
+	case floodWarn:
+		h.metrics.floodActions.WithLabelValues("warn").Inc()
+		return filter.Result{Verdict: filter.Flag, Code: client.CodeFloodWarning}
+	case floodMute:
+		h.metrics.floodActions.WithLabelValues("mute").Inc()
+		seconds := strconv.Itoa(int(math.Ceil(h.limits.FloodMute.Seconds())))
+		return filter.Result{Verdict: filter.Reject, Code: client.CodeFloodMuted, Data: map[string]string{"seconds": seconds}}
+	case floodMuted:
+		return filter.Result{Verdict: filter.Reject, Code: client.CodeStillMuted}
+	case floodKick:
+		h.metrics.floodActions.WithLabelValues("kick").Inc()
+		return filter.Result{Verdict: filter.Kick, Code: client.CodeKickedFlood, Reason: "flooding"}
+	}
+	return filter.Result{}
+}
@@ -0,0 +1,1529 @@
+package hub
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+	"github.com/Azeem01nnie/CatChat/pkg/filter"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ---------------------- WebSocket Upgrader ----------------------
+
+func newUpgrader(cfg Config) websocket.Upgrader {
+	return websocket.Upgrader{
+		ReadBufferSize:    cfg.Limits.ReadBufferSize,
+		WriteBufferSize:   cfg.Limits.WriteBufferSize,
+		CheckOrigin:       originChecker(cfg),
+		EnableCompression: cfg.Compression,
+	}
+}
+
+// ---------------------- Client & Hub Structs ----------------------
+
+// A client's teardown always runs the same way, whichever side starts it:
+//
+//   - The hub decides the client is done (its readPump exited, it was
+//     kicked, reaped as slow, suspended or the server is shutting down)
+//     and calls closeSend, which only the hub does. writePump drains what
+//     is queued, sends the close frame and closes the connection.
+//   - A read or write error closes the connection instead. The other pump
+//     then fails too; readPump unregisters the client, which brings the
+//     hub to closeSend as above.
+//
+// closeSend and closeConn each take effect once however many paths reach
+// them, so send is never closed twice and nothing is written after the
+// connection is closed.
+type Client struct {
+	id        string
+	conn      Conn
+	send      chan client.Message
+	hub       *Hub
+	interests []string
+	createdAt time.Time
+	bytesSent atomic.Int64
+	// wire counts the bytes written to the socket under conn, after any
+	// compression. It is nil for connections ServeConn was given.
+	wire *atomic.Int64
+	// connID identifies the connection in logs, and log carries it.
+	connID string
+	log    *slog.Logger
+	// abnormal makes sure a disconnect is counted under one reason only.
+	abnormal atomic.Bool
+	// lastActive is when the client last sent a frame that counts as
+	// activity, in Unix nanoseconds; see idle.go.
+	lastActive atomic.Int64
+
+	// The fields below are owned by the hub's run loop and must not be
+	// touched from the pumps.
+	partner      *Client
+	pairing      *pairing
+	waitingSince time.Time
+	fallback     *time.Timer
+	// bot is the client's cat companion while it waits, if it has one, and
+	// botTimer starts it; see bot.go.
+	bot      *catBot
+	botTimer *time.Timer
+	// recent holds the IDs of the latest limits.RecentPartners partners,
+	// newest last.
+	recent []string
+	// lastReceived is the ID of the latest message relayed to the client
+	// in its current pairing and lastAcked the latest it has acknowledged.
+	lastReceived uint64
+	lastAcked    uint64
+	// suspended is set while a dropped client waits to be resumed, with
+	// messages for it held back in held; see session.go.
+	suspended   bool
+	resumeTimer *time.Timer
+	held        []client.Message
+
+	// closeCode and closeReason are set by the hub before it closes send
+	// and read by writePump once the channel is closed.
+	closeCode   int
+	closeReason string
+	sendOnce    sync.Once
+	connOnce    sync.Once
+
+	// remote is set on proxies for clients hosted on another instance, and
+	// partnerID is the local client such a proxy was paired with. Both are
+	// fixed at creation; see newProxy.
+	remote    string
+	partnerID string
+
+	// resumeID is the session a new connection asked to resume, taken from
+	// a verified token before the client is registered.
+	resumeID string
+	// automated is set on bot participants, which have no connection; see
+	// botapi.go.
+	automated bool
+	// invite is the invite code a new connection came with, if any.
+	invite string
+	// lastPartnerIP is the address of the partner c may still rate, owned
+	// by the run loop.
+	lastPartnerIP netip.Addr
+	// group is set for clients that asked for a room instead of a partner,
+	// and room is the room they are in, owned by the run loop.
+	group bool
+	room  *room
+	// typing is the state of the client's typing indicator, owned by its
+	// readPump and the timer that expires it.
+	typing typingState
+	// flood tracks the client's flooding, owned by its readPump.
+	flood *floodDetector
+	// challenge is the challenge the client has yet to answer, if any, and
+	// challengeTimer disconnects it if it takes too long; see challenge.go.
+	// Both are owned by the run loop.
+	challenge      *client.Challenge
+	challengeTimer *time.Timer
+	// sessionStart is when the session began, carried over when it is
+	// resumed. limitTimer enforces the idle and session limits, and
+	// idleWarned is when the client was last warned it was idle.
+	sessionStart time.Time
+	limitTimer   *time.Timer
+	idleWarned   time.Time
+	// ip is the address the connection came from.
+	ip netip.Addr
+	// lang is the locale notices are rendered in.
+	lang string
+}
+
+// Hub owns all pairing state. Every change to it happens on the run loop;
+// clients only send events.
+type Hub struct {
+	limits   Limits
+	upgrader websocket.Upgrader
+	words    *wordList
+	reports  ReportStore
+	bans     *banList
+	strikes  *strikeTracker
+	ratings  *ratingTracker
+	backend  HubBackend
+	media    *mediaStore
+	catalog  *catalog
+	metrics  *metrics
+	maxConns int
+	// maxConnsPerIP caps the connections from one address, and
+	// trustedProxies are the proxies whose X-Forwarded-For is believed.
+	maxConnsPerIP  int
+	trustedProxies []netip.Prefix
+	// sessionKey signs session tokens.
+	sessionKey []byte
+	// filters are the custom filters added with AddMessageFilter; links
+	// configures the built-in link filter.
+	filters []filter.Filter
+	links   filter.LinkPolicy
+	// challenger, if set, vets new connections before they are matched.
+	challenger Challenger
+	// responder writes the replies of the bot companions.
+	responder Responder
+	tracer    trace.Tracer
+	webhooks  *webhookDispatcher
+	// adminToken guards the admin API and staticDir, if set, overrides the
+	// embedded frontend.
+	adminToken string
+	staticDir  string
+	// closers are the stores and backend New opened, and stopWatch stops
+	// polling the word list.
+	closers   []io.Closer
+	stopWatch context.CancelFunc
+
+	clients map[*Client]bool
+	// waiting holds queued clients in the order they were enqueued.
+	waiting []*Client
+	// slow collects clients whose send buffer overflowed during the current
+	// event; they are removed once the event has been handled.
+	slow []*Client
+	// proxies stand in for the partners of local clients that are hosted
+	// on other instances.
+	proxies map[string]*Client
+	// rooms holds the open group rooms for each tag.
+	rooms map[string][]*room
+	// invites maps unused invite codes to who issued them.
+	invites map[string]invite
+	// bots holds the session IDs of the bot participants.
+	bots map[string]bool
+
+	register   chan *Client
+	unregister chan *Client
+	expire     chan *Client
+	next       chan *Client
+	stats      chan *Client
+	relay      chan relayRequest
+	direct     chan directRequest
+	fallback   chan *Client
+	nudge      chan *pairing
+	report     chan reportRequest
+	admin      chan adminRequest
+	events     <-chan peerEvent
+	stop       chan struct{}
+	stopped    bool
+	// done is closed once run has returned after Shutdown. Senders give
+	// up on the channels above once it is.
+	done chan struct{}
+
+	// admitMu guards closing, conns and ipConns, which ServeWS checks
+	// before upgrading so no writer can be added to the WaitGroup once
+	// Shutdown is waiting on it, and lastOverload, when server_overloaded
+	// was last sent.
+	admitMu      sync.Mutex
+	closing      bool
+	conns        int
+	ipConns      map[netip.Addr]int
+	writers      sync.WaitGroup
+	lastOverload time.Time
+}
+
+// relayRequest forwards msg from a client to its partner.
+type relayRequest struct {
+	from *Client
+	msg  client.Message
+	// queued is when readPump sent a chat message or file, for tracing.
+	queued time.Time
+}
+
+// reportRequest files a report against a client's current partner.
+type reportRequest struct {
+	from   *Client
+	reason string
+}
+
+// directRequest sends msg to a client from the server.
+type directRequest struct {
+	to  *Client
+	msg client.Message
+}
+
+// ---------------------- Hub Functions ----------------------
+
+// New builds a hub from cfg, which should have passed Config.Validate, and
+// starts its run loop. The word list, stores and backend cfg names are
+// opened, unless opts supply stores, and closed again by Shutdown.
+func New(cfg Config, opts ...Option) (*Hub, error) {
+	o := options{reg: prometheus.DefaultRegisterer}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var closers []io.Closer
+	fail := func(msg string, err error) (*Hub, error) {
+		for _, c := range closers {
+			c.Close()
+		}
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	words, err := loadWordList(cfg.WordListPath)
+	if err != nil {
+		return fail("loading word list", err)
+	}
+
+	reports := o.reports
+	if reports == nil {
+		reports = newMemoryReportStore()
+		if cfg.ReportsDB != "" {
+			db, err := openSQLiteReportStore(cfg.ReportsDB)
+			if err != nil {
+				return fail("opening report store", err)
+			}
+			reports = db
+		}
+		closers = append(closers, reports)
+	}
+
+	banStore := o.bans
+	if banStore == nil {
+		banStore = newMemoryBanStore()
+		if cfg.BansDB != "" {
+			db, err := openSQLiteBanStore(cfg.BansDB)
+			if err != nil {
+				return fail("opening ban store", err)
+			}
+			banStore = db
+		}
+		closers = append(closers, banStore)
+	}
+	bans, err := loadBanList(context.Background(), banStore)
+	if err != nil {
+		return fail("loading bans", err)
+	}
+
+	var backend HubBackend = newMemoryBackend()
+	if cfg.Hub == "redis" {
+		rb, err := openRedisBackend(cfg.RedisAddr)
+		if err != nil {
+			return fail("connecting to redis", err)
+		}
+		backend = rb
+	}
+	closers = append(closers, backend)
+
+	h := newHub(cfg, words, reports, bans, backend, o.reg)
+	if cfg.LocalesDir != "" {
+		if err := h.catalog.LoadDir(cfg.LocalesDir); err != nil {
+			return fail("loading locales", err)
+		}
+	}
+	h.adminToken = cfg.AdminToken
+	h.staticDir = cfg.StaticDir
+	h.closers = closers
+	ctx, cancel := context.WithCancel(context.Background())
+	h.stopWatch = cancel
+	if cfg.WordListPath != "" && cfg.WordListPoll > 0 {
+		go words.watch(ctx, cfg.WordListPoll)
+	}
+	go h.run()
+	return h, nil
+}
+
+// Handler returns the hub's HTTP handler: the frontend at /, the WebSocket
+// endpoint at /ws, media uploads and downloads, and the admin API under
+// /admin/. Metrics are left to the caller, which owns the registry.
+func (h *Hub) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", newStaticHandler(staticFiles(h.staticDir), defaultStaticDeny))
+	mux.HandleFunc("/ws", h.ServeWS)
+	mux.HandleFunc("/upload", h.handleUpload)
+	mux.HandleFunc(mediaPath, h.handleMedia)
+	mux.Handle("/admin/", h.adminHandler(h.adminToken))
+	return mux
+}
+
+func newHub(cfg Config, words *wordList, reports ReportStore, bans *banList, backend HubBackend, reg prometheus.Registerer) *Hub {
+	h := &Hub{
+		limits:         cfg.Limits,
+		upgrader:       newUpgrader(cfg),
+		words:          words,
+		reports:        reports,
+		bans:           bans,
+		strikes:        newStrikeTracker(cfg.Limits),
+		ratings:        newRatingTracker(cfg.Limits),
+		backend:        backend,
+		media:          newMediaStore(cfg.Limits, cfg.MediaTypes),
+		catalog:        newCatalog(),
+		maxConns:       cfg.MaxConnections,
+		maxConnsPerIP:  cfg.MaxConnectionsPerIP,
+		trustedProxies: cfg.TrustedProxies,
+		sessionKey:     cfg.SessionKey(),
+		ipConns:        make(map[netip.Addr]int),
+		clients:        make(map[*Client]bool),
+		proxies:        make(map[string]*Client),
+		rooms:          make(map[string][]*room),
+		invites:        make(map[string]invite),
+		bots:           make(map[string]bool),
+		register:       make(chan *Client),
+		unregister:     make(chan *Client),
+		expire:         make(chan *Client),
+		next:           make(chan *Client),
+		stats:          make(chan *Client),
+		relay:          make(chan relayRequest),
+		direct:         make(chan directRequest),
+		fallback:       make(chan *Client),
+		nudge:          make(chan *pairing),
+		report:         make(chan reportRequest),
+		admin:          make(chan adminRequest),
+		events:         backend.Events(),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	h.metrics = newMetrics(reg, h)
+	// Config.Validate has already rejected a bad link policy.
+	h.links, _ = filter.NewLinkPolicy(cfg.LinkMode, cfg.LinkAllowlist)
+	h.challenger = newChallenger(cfg)
+	h.responder = newResponder(cfg)
+	h.tracer = otel.Tracer(tracerName)
+	h.webhooks = newWebhookDispatcher(cfg.WebhookURLs, cfg.WebhookSecret, cfg.WebhookEvents, cfg.Limits, h.metrics)
+	return h
+}
+
+func (h *Hub) run() {
+	statsTick, stopStats := h.statsTicker()
+	defer stopStats()
+	defer close(h.done)
+	for {
+		select {
+		case c := <-h.register:
+			if h.stopped {
+				c.closeCode, c.closeReason = websocket.CloseGoingAway, "server shutting down"
+				c.closeSend()
+				continue
+			}
+			if c.resumeID != "" && h.resume(c) {
+				continue
+			}
+			h.clients[c] = true
+			h.metrics.connections.Inc()
+			c.sessionStart = c.createdAt
+			h.armLimits(c)
+			msg := h.serverMessage("session", "")
+			msg.Token = h.sessionToken(c.id)
+			h.deliver(c, msg)
+			if h.challenger != nil {
+				h.challenge(c)
+			} else {
+				h.enter(c)
+			}
+
+		case c := <-h.unregister:
+			h.disconnect(c)
+
+		case c := <-h.expire:
+			h.expireSession(c)
+
+		case c := <-h.next:
+			if h.clients[c] && c.room != nil {
+				h.deliver(c, h.notice("system", client.CodeRoomNoNext, nil))
+			} else if h.clients[c] {
+				c.log.Info("next", "paired", c.partner != nil)
+				h.endBot(c)
+				h.unpair(c, client.CodePartnerNext)
+				h.match(c)
+			}
+
+		case c := <-h.stats:
+			if h.clients[c] {
+				h.deliver(c, h.statsMessage(c))
+			}
+
+		case <-statsTick:
+			h.broadcastStats()
+
+		case r := <-h.relay:
+			span := h.relaySpan(r)
+			h.relayMessage(r.from, r.msg)
+			span.End()
+
+		case d := <-h.direct:
+			if h.clients[d.to] {
+				h.deliver(d.to, d.msg)
+			}
+
+		case c := <-h.fallback:
+			h.fallbackPair(c)
+
+		case p := <-h.nudge:
+			h.nudgePairing(p)
+
+		case r := <-h.report:
+			h.fileReport(r.from, r.reason)
+
+		case req := <-h.admin:
+			req.run(h)
+
+		case ev, ok := <-h.events:
+			if !ok {
+				h.events = nil
+				continue
+			}
+			h.handlePeerEvent(ev)
+
+		case <-h.stop:
+			// closeAll leaves no clients behind to handle events for.
+			h.closeAll()
+			return
+		}
+		h.reapSlow()
+	}
+}
+
+// post sends v to the run loop on ch, or reports false if the hub has
+// shut down and nothing will ever receive it.
+func post[T any](h *Hub, ch chan<- T, v T) bool {
+	select {
+	case ch <- v:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+// admit reserves a writer for a new connection from ip. It fails with the
+// HTTP status to answer once Shutdown has started, the connection cap is
+// reached or ip already has its share of connections.
+func (h *Hub) admit(ip netip.Addr) (ok bool, status int, reason string) {
+	h.admitMu.Lock()
+	defer h.admitMu.Unlock()
+	switch {
+	case h.closing:
+		h.metrics.connectionsRejected.WithLabelValues("shutting_down").Inc()
+		return false, http.StatusServiceUnavailable, "server shutting down"
+	case h.maxConns > 0 && h.conns >= h.maxConns:
+		h.metrics.connectionsRejected.WithLabelValues("server_full").Inc()
+		if now := time.Now(); now.Sub(h.lastOverload) >= h.limits.OverloadNoticeEvery {
+			h.lastOverload = now
+			h.webhooks.send(EventServerOverloaded, serverOverloadedEvent{Connections: h.conns, MaxConnections: h.maxConns})
+		}
+		return false, http.StatusServiceUnavailable, "server full, try again later"
+	case h.maxConnsPerIP > 0 && h.ipConns[ip] >= h.maxConnsPerIP:
+		h.metrics.connectionsRejected.WithLabelValues("ip_limit").Inc()
+		return false, http.StatusTooManyRequests, "too many connections from your address"
+	}
+	h.conns++
+	h.ipConns[ip]++
+	h.writers.Add(1)
+	return true, 0, ""
+}
+
+// release undoes admit once a connection's writePump has exited.
+func (h *Hub) release(ip netip.Addr) {
+	h.admitMu.Lock()
+	h.conns--
+	if h.ipConns[ip]--; h.ipConns[ip] <= 0 {
+		delete(h.ipConns, ip)
+	}
+	h.admitMu.Unlock()
+	h.writers.Done()
+}
+
+// Shutdown tells every client the server is going away, closes their
+// connections with a going-away close frame and waits for their writePumps
+// to flush, or for ctx to expire. The run loop stops once every client is
+// gone, and the stores and backend New opened are closed on the way out.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.stopWatch()
+	defer func() {
+		for _, c := range h.closers {
+			c.Close()
+		}
+	}()
+	h.admitMu.Lock()
+	h.closing = true
+	h.admitMu.Unlock()
+
+	post(h, h.stop, struct{}{})
+
+	done := make(chan struct{})
+	go func() {
+		h.writers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return h.webhooks.Close(ctx)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closeAll runs on the hub for Shutdown. Pairings are dissolved without
+// requeueing anyone on this instance, since nobody will be matched again
+// here; partners on other instances are told to look for someone new.
+func (h *Hub) closeAll() {
+	h.stopped = true
+	for c := range h.clients {
+		c.stopTimers()
+		h.endBot(c)
+		h.leave(c)
+		if p := c.partner; p != nil && p.remote != "" {
+			h.publish(p.remote, peerEvent{Kind: "unpair", From: c.id, To: p.id, Reason: client.CodePartnerLeft})
+			h.dropProxy(p)
+		}
+		if c.pairing != nil {
+			c.pairing.end()
+		}
+		c.partner, c.pairing = nil, nil
+		h.deliver(c, h.notice("server_shutdown", client.CodeServerShutdown, nil))
+		delete(h.clients, c)
+		h.metrics.connections.Dec()
+		// A suspended client's writePump has already read its close code
+		// and gone.
+		if !c.suspended {
+			c.closeCode, c.closeReason = websocket.CloseGoingAway, "server shutting down"
+			c.closeSend()
+		}
+	}
+	h.slow = nil
+}
+
+// deliver queues msg for c without ever blocking the run loop. Once the
+// queue reaches limits.SendHighWater, typing notifications and stats are
+// dropped to leave room for chat messages; a client whose queue is full is
+// disconnected as a slow consumer.
+func (h *Hub) deliver(c *Client, msg client.Message) {
+	msg = h.localize(c, msg)
+	queued := len(c.send)
+	if c.suspended {
+		queued = len(c.held)
+	}
+	if queued >= h.limits.SendHighWater && (msg.Type == "typing_start" || msg.Type == "typing_stop" || msg.Type == "stats") {
+		h.metrics.messagesDropped.Inc()
+		return
+	}
+	if c.suspended {
+		if len(c.held) < h.limits.SendBuffer {
+			c.held = append(c.held, msg)
+		} else {
+			h.markSlow(c)
+		}
+		return
+	}
+	select {
+	case c.send <- msg:
+	default:
+		h.markSlow(c)
+	}
+}
+
+// markSlow schedules c for removal once the current event is handled.
+func (h *Hub) markSlow(c *Client) {
+	for _, s := range h.slow {
+		if s == c {
+			return
+		}
+	}
+	h.slow = append(h.slow, c)
+}
+
+func (h *Hub) reapSlow() {
+	for len(h.slow) > 0 {
+		c := h.slow[0]
+		h.slow = h.slow[1:]
+		c.noteAbnormal("slow_consumer")
+		c.closeCode, c.closeReason = websocket.CloseTryAgainLater, "slow_consumer"
+		h.remove(c)
+	}
+}
+
+// remove tears down c, closing its send channel, and is a no-op for
+// clients that are already gone.
+func (h *Hub) remove(c *Client) {
+	if c.remote != "" {
+		h.removeProxy(c)
+		return
+	}
+	if !h.clients[c] {
+		return
+	}
+	delete(h.clients, c)
+	delete(h.bots, c.id)
+	h.metrics.connections.Dec()
+	reason := c.closeReason
+	switch {
+	case reason != "":
+	case c.abnormal.Load():
+		reason = "connection lost"
+	default:
+		reason = "closed by client"
+	}
+	c.log.Info("disconnected", "reason", reason, "seconds", int(time.Since(c.createdAt).Seconds()))
+	_, span := h.startSpan(context.Background(), "catchat.teardown", c, trace.WithAttributes(attrReason.String(reason)))
+	defer span.End()
+	// A suspended client's send channel was closed when it was suspended.
+	suspended := c.suspended
+	c.suspended = false
+	c.stopTimers()
+	h.leave(c)
+	h.leaveRoom(c)
+	h.unpair(c, client.CodePartnerLeft)
+	if !suspended {
+		c.closeSend()
+	}
+}
+
+// stopTimers stops c's resume, challenge and limit timers.
+func (c *Client) stopTimers() {
+	for _, t := range []*time.Timer{c.resumeTimer, c.challengeTimer, c.limitTimer} {
+		if t != nil {
+			t.Stop()
+		}
+	}
+}
+
+// kick sends c a kicked message with the notice for why, then closes its
+// connection with CloseKicked and reason.
+func (h *Hub) kick(c *Client, reason, notice string) {
+	h.eject(c, client.CloseKicked, reason, h.notice("kicked", notice, nil))
+}
+
+// eject delivers msg to c and closes its connection with closeCode and
+// reason, which msg repeats for clients that only see messages.
+func (h *Hub) eject(c *Client, closeCode int, reason string, msg client.Message) {
+	if !h.clients[c] {
+		return
+	}
+	msg.Reason = reason
+	h.deliver(c, msg)
+	c.closeCode, c.closeReason = closeCode, reason
+	h.remove(c)
+}
+
+// unpair ends c's current pairing, if any, sends the partner the notice
+// code for why and puts the partner back in the queue.
+func (h *Hub) unpair(c *Client, code string) {
+	if partner := h.detach(c, code); partner != nil {
+		h.match(partner)
+	}
+}
+
+// detach is unpair without the requeue: it returns the local partner that
+// should be matched again, or nil if there is none.
+func (h *Hub) detach(c *Client, code string) *Client {
+	partner := c.partner
+	if partner == nil {
+		return nil
+	}
+	c.pairing.end()
+	c.partner, c.pairing = nil, nil
+	partner.partner, partner.pairing = nil, nil
+	c.lastPartnerIP, partner.lastPartnerIP = partner.ip, c.ip
+
+	if partner.remote != "" {
+		h.publish(partner.remote, peerEvent{Kind: "unpair", From: c.id, To: partner.id, Reason: code})
+		h.dropProxy(partner)
+		return nil
+	}
+	// A suspended client only waits to get its pairing back.
+	if partner.suspended {
+		h.remove(partner)
+		return nil
+	}
+	h.deliver(partner, h.notice("partner_left", code, nil))
+	return partner
+}
+
+// enter sends a new client on to its room, the partner that invited it or
+// the waiting pool.
+func (h *Hub) enter(c *Client) {
+	if c.group {
+		h.joinRoom(c)
+	} else if c.invite == "" || !h.redeemInvite(c) {
+		h.match(c)
+	}
+}
+
+// match pairs c with the best waiting client, or queues it. If the
+// backend can't be reached, c still waits locally and is retried when its
+// fallback timer fires.
+func (h *Hub) match(c *Client) {
+	if !h.clients[c] || c.challenge != nil {
+		return
+	}
+	spanCtx, span := h.startSpan(context.Background(), "catchat.match", c)
+	defer endMatchSpan(span, c)
+	for {
+		ctx, cancel := context.WithTimeout(spanCtx, h.limits.BackendTimeout)
+		w, shared, ok, err := h.backend.Match(ctx, h.entry(c), h.limits.AnyTagAfter)
+		cancel()
+		if err != nil {
+			c.log.Error("matching", "err", err)
+		}
+		if !ok {
+			break
+		}
+		if partner := h.resolve(c, w, shared); partner != nil {
+			h.metrics.pairsFormed.Inc()
+			h.pair(c, partner, shared)
+			return
+		}
+	}
+	h.enqueue(c)
+	h.deliver(c, h.notice("waiting", client.CodeWaiting, map[string]string{"interests": strings.Join(c.interests, ", ")}))
+}
+
+// fallbackPair runs when c has waited limits.AnyTagAfter without a match,
+// moving it into the general pool. It pairs c with the longest-waiting
+// client already there, regardless of interests; from now on anyone
+// without a better match may take c as well.
+func (h *Hub) fallbackPair(c *Client) {
+	if !h.isWaiting(c) {
+		return
+	}
+	h.deliver(c, h.notice("fallback", client.CodeFallback, nil))
+	spanCtx, span := h.startSpan(context.Background(), "catchat.fallback_match", c)
+	defer endMatchSpan(span, c)
+	ctx, cancel := context.WithTimeout(spanCtx, h.limits.BackendTimeout)
+	w, ok, err := h.backend.MatchAny(ctx, h.entry(c), h.limits.AnyTagAfter)
+	cancel()
+	if err != nil {
+		c.log.Error("fallback matching", "err", err)
+	}
+	if !ok {
+		return
+	}
+	shared := sharedInterests(c.interests, w.Interests)
+	partner := h.resolve(c, w, shared)
+	if partner == nil {
+		// The entry was stale and c has left the pool with it.
+		h.match(c)
+		return
+	}
+	h.metrics.pairsFormed.Inc()
+	h.pair(c, partner, shared)
+}
+
+func (h *Hub) pair(c, w *Client, shared []string) {
+	now := time.Now()
+	for _, cl := range []*Client{c, w} {
+		if cl.remote != "" {
+			continue
+		}
+		wait := time.Duration(0)
+		if h.isWaiting(cl) {
+			wait = now.Sub(cl.waitingSince)
+		}
+		h.metrics.waitSeconds.Observe(wait.Seconds())
+		h.handOff(cl)
+	}
+
+	h.dequeue(c)
+	h.dequeue(w)
+	c.rememberPartner(w.id, h.limits.RecentPartners)
+	w.rememberPartner(c.id, h.limits.RecentPartners)
+	c.lastReceived, c.lastAcked = 0, 0
+	w.lastReceived, w.lastAcked = 0, 0
+	p := newPairing(h, c, w)
+	c.partner, c.pairing = w, p
+	w.partner, w.pairing = c, p
+
+	msg := h.notice("paired", client.CodePaired, nil)
+	if len(shared) > 0 {
+		msg = h.notice("paired", client.CodePairedShared, map[string]string{"interests": strings.Join(shared, ", ")})
+	}
+	msg.Interests = shared
+	h.deliver(c, msg)
+	h.deliver(w, msg)
+	slog.Info("paired", "pair", p.id, "conn", c.connID, "partner", w.connID, "shared", shared)
+	h.webhooks.send(EventPairCreated, pairCreatedEvent{PairID: p.id, A: c.id, B: w.id, Shared: shared})
+}
+
+// setInterests switches c to new interests. A waiting client is moved to
+// the new ones in a single step, which may pair it straight away; a
+// paired one keeps its partner and uses them on its next match, and a
+// room member moves to the room for its new first interest.
+func (h *Hub) setInterests(c *Client, interests []string) {
+	if !h.clients[c] {
+		return
+	}
+	c.interests = interests
+	switch {
+	case c.room != nil:
+		h.leaveRoom(c)
+		h.joinRoom(c)
+	case h.isWaiting(c):
+		h.leave(c)
+		h.match(c)
+	default:
+		h.deliver(c, h.notice("system", client.CodeInterestsSet, map[string]string{"interests": strings.Join(interests, ", ")}))
+	}
+}
+
+// rememberPartner adds id to c's recent partners, keeping the latest n.
+func (c *Client) rememberPartner(id string, n int) {
+	if n == 0 {
+		return
+	}
+	c.recent = append(c.recent, id)
+	if len(c.recent) > n {
+		c.recent = append([]string(nil), c.recent[len(c.recent)-n:]...)
+	}
+}
+
+func (h *Hub) enqueue(c *Client) {
+	if h.isWaiting(c) {
+		return
+	}
+	c.waitingSince = time.Now()
+	h.waiting = append(h.waiting, c)
+	// Bots just wait to be found: the fallback would match them with
+	// other bots.
+	if c.automated {
+		return
+	}
+	c.fallback = time.AfterFunc(h.limits.AnyTagAfter, func() { post(h, h.fallback, c) })
+	if h.limits.BotAfter > 0 {
+		c.botTimer = time.AfterFunc(h.limits.BotAfter, func() {
+			h.do(func() { h.startBot(c) })
+		})
+	}
+}
+
+func (h *Hub) dequeue(c *Client) {
+	for i, w := range h.waiting {
+		if w == c {
+			h.waiting = append(h.waiting[:i], h.waiting[i+1:]...)
+			break
+		}
+	}
+	if c.fallback != nil {
+		c.fallback.Stop()
+		c.fallback = nil
+	}
+	if c.botTimer != nil {
+		c.botTimer.Stop()
+		c.botTimer = nil
+	}
+	h.endBot(c)
+}
+
+// leave takes c out of the shared waiting pool as well as the local queue.
+func (h *Hub) leave(c *Client) {
+	if h.isWaiting(c) {
+		ctx, cancel := context.WithTimeout(context.Background(), h.limits.BackendTimeout)
+		if err := h.backend.Remove(ctx, c.id); err != nil {
+			c.log.Error("leaving waiting pool", "err", err)
+		}
+		cancel()
+	}
+	h.dequeue(c)
+}
+
+// entry describes c to the waiting pool. Low-rated clients are entered as
+// if they had started waiting later, so others get matched first.
+func (h *Hub) entry(c *Client) waitEntry {
+	since := time.Now()
+	if h.isWaiting(c) {
+		since = c.waitingSince
+	}
+	if h.ratings.low(c.ip) {
+		since = since.Add(h.limits.LowRatingPenalty)
+	}
+	avoid := c.recent
+	if c.automated {
+		avoid = slices.Clip(avoid)
+		for id := range h.bots {
+			avoid = append(avoid, id)
+		}
+	}
+	return waitEntry{ID: c.id, Instance: h.backend.Instance(), Interests: c.interests, Since: since, Avoid: avoid}
+}
+
+func (h *Hub) isWaiting(c *Client) bool {
+	for _, w := range h.waiting {
+		if w == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hub) relayMessage(from *Client, msg client.Message) {
+	if !h.clients[from] && h.proxies[from.id] != from {
+		return
+	}
+	if from.room != nil {
+		h.roomMessage(from, msg)
+		return
+	}
+	if from.partner == nil && from.bot != nil && msg.Type == "message" {
+		h.tellBot(from, msg.Text)
+		return
+	}
+	if from.partner == nil {
+		switch msg.Type {
+		case "message", "media":
+			h.deliver(from, h.notice("system", client.CodeNoPartner, nil))
+		case "offer":
+			h.deliver(from, h.notice("system", client.CodeNoCallPartner, nil))
+		}
+		return
+	}
+	switch msg.Type {
+	case "message":
+		from.pairing.noteMessage()
+		from.pairing.transcript.add(TranscriptLine{From: from.id, Text: msg.Text, At: time.Now()})
+		// Messages from a proxy were numbered on their sender's instance.
+		if from.remote == "" {
+			h.metrics.messagesRelayed.Inc()
+			msg.ID = from.pairing.nextID()
+			sent := h.serverMessage("sent", "")
+			sent.ID = msg.ID
+			h.deliver(from, sent)
+		}
+		from.partner.lastReceived = msg.ID
+
+	case "media":
+		from.pairing.noteMessage()
+		from.pairing.transcript.add(TranscriptLine{From: from.id, Text: "[shared " + msg.Media.Type + "]", At: time.Now()})
+		if from.remote == "" {
+			h.metrics.messagesRelayed.Inc()
+		}
+
+	case "ack":
+		// Acks are cumulative, so a client can only acknowledge a message
+		// it has received and hasn't acknowledged yet.
+		if from.remote == "" {
+			if msg.ID <= from.lastAcked || msg.ID > from.lastReceived {
+				return
+			}
+			from.lastAcked = msg.ID
+		}
+	}
+	msg.From = client.FromPartner
+	h.stamp(&msg, time.Now())
+	h.deliver(from.partner, msg)
+	if msg.Type == "message" || msg.Type == "media" {
+		h.notifyObservers(from, msg)
+	}
+}
+
+// fileReport snapshots the pairing's transcript and saves the report off
+// the run loop, replying to the reporter once it is stored.
+func (h *Hub) fileReport(from *Client, reason string) {
+	if !h.clients[from] {
+		return
+	}
+	if from.room != nil {
+		h.deliver(from, h.notice("system", client.CodeRoomNoReport, nil))
+		return
+	}
+	if from.partner == nil {
+		h.deliver(from, h.notice("system", client.CodeNoReportPartner, nil))
+		return
+	}
+
+	report := &Report{
+		CreatedAt:  time.Now(),
+		ReporterID: from.id,
+		ReportedID: from.partner.id,
+		ReportedIP: ipString(from.partner.ip),
+		Reason:     reason,
+		Transcript: from.pairing.transcript.snapshot(),
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), h.limits.StoreTimeout)
+		defer cancel()
+		code := client.CodeReportSaved
+		if err := h.reports.Save(ctx, report); err != nil {
+			from.log.Error("saving report", "err", err)
+			code = client.CodeReportFailed
+		} else {
+			h.webhooks.send(EventReportFiled, reportFiledEvent{
+				ReportID:   report.ID,
+				ReporterID: report.ReporterID,
+				ReportedID: report.ReportedID,
+				ReportedIP: report.ReportedIP,
+				Reason:     report.Reason,
+			})
+		}
+		post(h, h.direct, directRequest{to: from, msg: h.notice("system", code, nil)})
+	}()
+}
+
+// ---------------------- Interests ----------------------
+
+// parseInterests splits a comma-separated interest list, normalising case
+// and dropping blanks and duplicates. An empty list becomes "default".
+func parseInterests(raw string, max int) []string {
+	var interests []string
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(raw, ",") {
+		tag := strings.ToLower(strings.TrimSpace(part))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		interests = append(interests, tag)
+		if len(interests) == max {
+			break
+		}
+	}
+	if len(interests) == 0 {
+		interests = []string{"default"}
+	}
+	return interests
+}
+
+func sharedInterests(a, b []string) []string {
+	var shared []string
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				shared = append(shared, x)
+				break
+			}
+		}
+	}
+	return shared
+}
+
+// ---------------------- Client Functions ----------------------
+
+func (h *Hub) serverMessage(msgType, text string) client.Message {
+	msg := client.Message{Type: msgType, From: client.FromServer, Text: text}
+	h.stamp(&msg, time.Now())
+	return msg
+}
+
+// stamp sets msg's timestamps to t, in UTC so clients can show it in their
+// own time zone.
+func (h *Hub) stamp(msg *client.Message, t time.Time) {
+	t = t.UTC()
+	msg.Timestamp = t.Format(h.limits.TimestampFormat)
+	msg.Time = t.UnixMilli()
+}
+
+// closeSend closes c.send, ending writePump once it has flushed the
+// queue. Only the hub calls it.
+func (c *Client) closeSend() {
+	c.sendOnce.Do(func() { close(c.send) })
+}
+
+// closeConn closes the connection, from whichever pump gets there first.
+func (c *Client) closeConn() {
+	c.connOnce.Do(func() { c.conn.Close() })
+}
+
+// reply sends msg to c itself via the hub, which owns c.send.
+func (c *Client) reply(msg client.Message) {
+	post(c.hub, c.hub.direct, directRequest{to: c, msg: msg})
+}
+
+func (c *Client) readPump() {
+	defer func() {
+		c.typingStop(false)
+		post(c.hub, c.hub.unregister, c)
+		c.closeConn()
+	}()
+
+	pongWait := c.hub.limits.PongWait()
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	// Frames over the limit make the connection close with 1009 (message
+	// too big) before they are buffered.
+	c.conn.SetReadLimit(int64(c.hub.limits.MaxFrameBytes))
+
+	limiter := newRateLimiter(c.hub.limits)
+	c.flood = newFloodDetector(c.hub.limits)
+	kicked := false
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if reason := readDisconnectReason(err); reason != "" {
+				c.noteAbnormal(reason)
+			}
+			return
+		}
+		// Once kicked, keep reading until writePump has sent the close
+		// frame and closed the connection.
+		if kicked {
+			continue
+		}
+		// encoding/json would quietly replace invalid UTF-8, so check the
+		// frame first.
+		var msg client.Message
+		if !utf8.Valid(data) || json.Unmarshal(data, &msg) != nil {
+			c.reply(c.hub.notice("error", client.CodeInvalidMessage, nil))
+			continue
+		}
+		if activeFrame(msg.Type) {
+			c.touch()
+		}
+
+		if bucket := limiter.bucket(msg.Type); bucket != nil && !bucket.allow(time.Now()) {
+			if limiter.violate(time.Now()) {
+				c.hub.do(func() {
+					c.hub.kick(c, "rate limit exceeded", client.CodeKickedRateLimit)
+				})
+				kicked = true
+				continue
+			}
+			if msg.Type == "message" {
+				c.reply(c.hub.notice("rate_limited", client.CodeRateLimited, nil))
+			}
+			continue
+		}
+
+		switch msg.Type {
+		case "message":
+			text, res := c.hub.filterMessage(c, msg.Text)
+			if res.Verdict != filter.Pass || text != msg.Text {
+				c.log.Info("message filtered", "verdict", res.Verdict.String(), "code", res.Code, "rewritten", text != msg.Text)
+			}
+			switch res.Verdict {
+			case filter.Kick:
+				if !res.Strike || !c.hub.strike(c.ip, res.Reason) {
+					c.hub.do(func() {
+						c.hub.kick(c, res.Reason, res.Code)
+					})
+				}
+				kicked = true
+				continue
+			case filter.Reject:
+				c.reply(c.hub.notice("blocked", res.Code, res.Data))
+				continue
+			}
+			c.typingStop(false)
+			post(c.hub, c.hub.relay, relayRequest{from: c, msg: client.Message{Type: "message", Text: text}, queued: time.Now()})
+			if res.Verdict == filter.Flag {
+				c.reply(c.hub.notice("warning", res.Code, res.Data))
+			}
+
+		case "next":
+			if c.coolingDown(limiter, time.Now()) {
+				continue
+			}
+			post(c.hub, c.hub.next, c)
+
+		case "typing_start", "typing":
+			c.typingStart(time.Now())
+
+		case "typing_stop":
+			c.typingStop(true)
+
+		case "challenge_response":
+			c.answerChallenge(msg.Token)
+
+		case "rate_partner":
+			if msg.Rating == nil || !msg.Rating.Valid() {
+				c.reply(c.hub.notice("error", client.CodeInvalidMessage, nil))
+				continue
+			}
+			rating := *msg.Rating
+			c.hub.do(func() { c.hub.ratePartner(c, rating) })
+
+		case "invite":
+			c.hub.do(func() { c.hub.createInvite(c) })
+
+		case "set_tag":
+			if c.coolingDown(limiter, time.Now()) {
+				continue
+			}
+			interests := parseInterests(strings.Join(msg.Interests, ","), c.hub.limits.MaxInterests)
+			c.hub.do(func() { c.hub.setInterests(c, interests) })
+
+		case "ack":
+			post(c.hub, c.hub.relay, relayRequest{from: c, msg: client.Message{Type: "ack", ID: msg.ID}})
+
+		case "media":
+			if msg.Media == nil {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), c.hub.limits.MediaCheckTimeout)
+			err := c.hub.media.check(ctx, msg.Media)
+			cancel()
+			if err != nil {
+				c.reply(c.hub.notice("media_rejected", mediaNoticeCode(err), nil))
+				continue
+			}
+			post(c.hub, c.hub.relay, relayRequest{from: c, msg: client.Message{Type: "media", Media: msg.Media}, queued: time.Now()})
+
+		case "offer", "answer", "ice_candidate":
+			if len(msg.Signal) == 0 {
+				continue
+			}
+			if len(msg.Signal) > c.hub.limits.MaxSignalBytes {
+				c.reply(c.hub.notice("system", client.CodeSignalTooLarge, nil))
+				continue
+			}
+			post(c.hub, c.hub.relay, relayRequest{from: c, msg: client.Message{Type: msg.Type, Signal: msg.Signal}})
+
+		case "report":
+			post(c.hub, c.hub.report, reportRequest{from: c, reason: truncateRunes(msg.Reason, c.hub.limits.MaxReasonLength)})
+
+		case "stats":
+			post(c.hub, c.hub.stats, c)
+
+		case "usage":
+			msg := c.hub.serverMessage("usage", "")
+			msg.Bytes = c.bytesSent.Load()
+			c.reply(msg)
+		}
+	}
+}
+
+// writePump runs until the hub closes c.send or a write fails, pinging the
+// client every limits.PingInterval. Closing the connection makes readPump
+// exit, which unregisters the client.
+func (c *Client) writePump() {
+	limits := c.hub.limits
+	ticker := time.NewTicker(limits.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.closeConn()
+		c.hub.release(c.ip)
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(limits.WriteWait))
+			if !ok {
+				code := c.closeCode
+				if code == 0 {
+					code = websocket.CloseNormalClosure
+				}
+				c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, c.closeReason))
+				return
+			}
+			if err := c.writeFrame(msg); err != nil {
+				c.noteAbnormal("write_error")
+				return
+			}
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(limits.WriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeFrame encodes msg as a single text frame, adds the frame's size to
+// the client's running byte total and records it by message type. The
+// size is what reached the socket, so it is after compression and
+// includes the frame header; a pong written meanwhile by readPump is
+// counted with it. Connections without a socket count the encoded JSON.
+func (c *Client) writeFrame(msg client.Message) error {
+	var before int64
+	if c.wire != nil {
+		before = c.wire.Load()
+	}
+	w, err := c.conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+	cw := &countingWriter{w: w}
+	err = json.NewEncoder(cw).Encode(msg)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	n := cw.n
+	if c.wire != nil {
+		n = c.wire.Load() - before
+	}
+	c.bytesSent.Add(n)
+	c.hub.metrics.frameBytes.WithLabelValues(msg.Type).Observe(float64(n))
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// ---------------------- Silent Pairing Nudges ----------------------
+
+var icebreakers = []string{
+	"If you were a cat, what would your name be?",
+	"What's the best thing that happened to you this week?",
+	"Tea, coffee, or a saucer of milk?",
+	"What are you listening to right now?",
+	"Favourite place you've ever visited?",
+}
+
+// pairing is owned by the hub's run loop, like the Client fields it links.
+type pairing struct {
+	// id identifies the pairing in logs and traces.
+	id         string
+	a, b       *Client
+	since      time.Time
+	timer      *time.Timer
+	nudges     int
+	spoken     bool
+	ended      bool
+	transcript *transcript
+	lastID     uint64
+	// observers are the moderators watching this pairing.
+	observers []*observer
+}
+
+func newPairing(h *Hub, a, b *Client) *pairing {
+	p := &pairing{id: newConnID(), a: a, b: b, since: time.Now(), transcript: newTranscript(h.limits.TranscriptSize)}
+	p.timer = time.AfterFunc(h.limits.NudgeAfter, func() { post(h, h.nudge, p) })
+	return p
+}
+
+// nextID returns the ID for the next chat message relayed in p.
+func (p *pairing) nextID() uint64 {
+	p.lastID++
+	return p.lastID
+}
+
+// noteMessage records that a message was relayed, which stops any further
+// nudges for this pairing.
+func (p *pairing) noteMessage() {
+	if !p.spoken {
+		p.spoken = true
+		p.timer.Stop()
+	}
+}
+
+func (p *pairing) end() {
+	p.ended = true
+	p.timer.Stop()
+	p.transcript.purge()
+	p.endObservation()
+}
+
+func (h *Hub) nudgePairing(p *pairing) {
+	if p.spoken || p.ended {
+		return
+	}
+
+	if p.nudges == 0 {
+		opener := icebreakers[rand.Intn(len(icebreakers))]
+		msg := h.notice("nudge", client.CodeNudge, map[string]string{"opener": opener})
+		h.deliver(p.a, msg)
+		h.deliver(p.b, msg)
+		p.nudges++
+		p.timer.Reset(h.limits.NudgeAfter)
+		return
+	}
+	msg := h.notice("find_new_partner", client.CodeFindNewPartner, nil)
+	h.deliver(p.a, msg)
+	h.deliver(p.b, msg)
+}
+
+// ---------------------- Profanity Filter ----------------------
+var defaultBlockedWords = []string{"badword", "swear", "blocked"}
+
+// ---------------------- Serving Connections ----------------------
+
+func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
+	connID := newConnID()
+	_, span := h.tracer.Start(r.Context(), "catchat.upgrade", trace.WithAttributes(attrConnID.String(connID)))
+	defer span.End()
+	ip := h.clientIP(r)
+	if ok, status, reason := h.accept(ip); !ok {
+		http.Error(w, reason, status)
+		return
+	}
+	wire := new(atomic.Int64)
+	conn, err := h.upgrader.Upgrade(countingHijacker{w, wire}, r, nil)
+	if err != nil {
+		h.release(ip)
+		slog.Error("upgrade", "err", err)
+		return
+	}
+	h.attach(conn, wire, r, connID, ip)
+}
+
+// ServeConn serves conn, a connection set up by some other means, as
+// ServeWS does an upgraded one; r supplies the query parameters, headers
+// and address ServeWS would have read. If the address is banned or over
+// its limits conn is left open and an error returned.
+func (h *Hub) ServeConn(conn Conn, r *http.Request) error {
+	ip := h.clientIP(r)
+	if ok, _, reason := h.accept(ip); !ok {
+		return errors.New(reason)
+	}
+	h.attach(conn, nil, r, newConnID(), ip)
+	return nil
+}
+
+// accept admits a connection from ip, or returns the status and reason to
+// refuse it with.
+func (h *Hub) accept(ip netip.Addr) (ok bool, status int, reason string) {
+	if _, banned := h.bans.Check(ip); banned {
+		h.metrics.connectionsRejected.WithLabelValues("banned").Inc()
+		return false, http.StatusForbidden, "banned"
+	}
+	return h.admit(ip)
+}
+
+// attach registers a client for an admitted connection and starts its
+// pumps. wire, if not nil, counts the bytes written to its socket.
+func (h *Hub) attach(conn Conn, wire *atomic.Int64, r *http.Request, connID string, ip netip.Addr) {
+	c := &Client{
+		id:        newSessionID(),
+		connID:    connID,
+		log:       slog.With("conn", connID),
+		conn:      conn,
+		wire:      wire,
+		send:      make(chan client.Message, h.limits.SendBuffer),
+		hub:       h,
+		interests: parseInterests(r.URL.Query().Get("tag"), h.limits.MaxInterests),
+		createdAt: time.Now(),
+		group:     r.URL.Query().Get("mode") == "group",
+		ip:        ip,
+		lang:      h.catalog.Match(r.URL.Query().Get("lang"), r.Header.Get("Accept-Language")),
+		invite:    r.URL.Query().Get("invite"),
+	}
+	c.touch()
+	if token := r.URL.Query().Get("resume"); token != "" {
+		c.resumeID, _ = h.verifySessionToken(token)
+	}
+	c.log.Info("connected", "ip", ipString(ip), "group", c.group, "resume", c.resumeID != "")
+
+	if !post(h, h.register, c) {
+		// The hub has shut down; the writePump just sends the close frame.
+		c.closeCode, c.closeReason = websocket.CloseGoingAway, "server shutting down"
+		c.closeSend()
+	}
+	go c.writePump()
+	go c.readPump()
+}
+
+// newSessionID returns a random identifier for a connection. It is never
+// derived from anything about the user.
+func newSessionID() string {
+	b := make([]byte, 8)
+	if _, err := cryptorand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
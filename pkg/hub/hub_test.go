@@ -0,0 +1,507 @@
+package hub_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+	"github.com/Azeem01nnie/CatChat/pkg/hub"
+	"github.com/Azeem01nnie/CatChat/pkg/hub/hubtest"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newTestHub starts a hub configured by args, shut down when the test
+// ends.
+func newTestHub(t *testing.T, args ...string) *hub.Hub {
+	t.Helper()
+	return newTestHubMetrics(t, prometheus.NewRegistry(), args...)
+}
+
+// newTestHubMetrics is newTestHub with the hub's metrics registered with
+// reg.
+func newTestHubMetrics(t *testing.T, reg prometheus.Registerer, args ...string) *hub.Hub {
+	t.Helper()
+	cfg, err := hub.LoadConfig(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := hub.New(cfg, hub.WithRegisterer(reg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := h.Shutdown(ctx); err != nil {
+			t.Errorf("shutdown: %v", err)
+		}
+	})
+	return h
+}
+
+// dial connects a client interested in tag.
+func dial(t *testing.T, h *hub.Hub, tag string) *hubtest.Conn {
+	t.Helper()
+	c, err := hubtest.Dial(h, url.Values{"tag": {tag}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// recv returns the next message of type typ c receives.
+func recv(t *testing.T, c *hubtest.Conn, typ string) client.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := c.RecvType(ctx, typ)
+	if err != nil {
+		t.Fatalf("waiting for %s: %v", typ, err)
+	}
+	return msg
+}
+
+func send(t *testing.T, c *hubtest.Conn, msg client.Message) {
+	t.Helper()
+	if err := c.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPairing(t *testing.T) {
+	h := newTestHub(t)
+	a := dial(t, h, "cats")
+	recv(t, a, "waiting")
+	b := dial(t, h, "cats")
+
+	for _, c := range []*hubtest.Conn{a, b} {
+		msg := recv(t, c, "paired")
+		if msg.Code != client.CodePairedShared || len(msg.Interests) != 1 || msg.Interests[0] != "cats" {
+			t.Errorf("paired = %+v, want shared interest cats", msg)
+		}
+	}
+
+	send(t, a, client.Message{Type: "message", Text: "hello"})
+	if msg := recv(t, b, "message"); msg.Text != "hello" {
+		t.Errorf("b got %q, want hello", msg.Text)
+	}
+	send(t, b, client.Message{Type: "message", Text: "hi back"})
+	if msg := recv(t, a, "message"); msg.Text != "hi back" {
+		t.Errorf("a got %q, want hi back", msg.Text)
+	}
+}
+
+func TestNextRequeuesBoth(t *testing.T) {
+	h := newTestHub(t)
+	a := dial(t, h, "cats")
+	b := dial(t, h, "cats")
+	recv(t, a, "paired")
+	recv(t, b, "paired")
+
+	send(t, b, client.Message{Type: "next"})
+	if msg := recv(t, a, "partner_left"); msg.Code != client.CodePartnerNext {
+		t.Errorf("a's partner_left code = %s, want %s", msg.Code, client.CodePartnerNext)
+	}
+	recv(t, a, "waiting")
+	recv(t, b, "waiting")
+
+	// a and b were just partners, so each newcomer is paired with one of
+	// them rather than them with each other.
+	c := dial(t, h, "cats")
+	d := dial(t, h, "cats")
+	recv(t, c, "paired")
+	recv(t, d, "paired")
+	for _, x := range []*hubtest.Conn{a, b} {
+		recv(t, x, "paired")
+	}
+}
+
+func TestTeardownRace(t *testing.T) {
+	h := newTestHub(t)
+	const pairs = 20
+	var conns []*hubtest.Conn
+	for i := 0; i < pairs; i++ {
+		x := dial(t, h, "race")
+		y := dial(t, h, "race")
+		recv(t, x, "paired")
+		recv(t, y, "paired")
+		conns = append(conns, x, y)
+	}
+
+	// One side of every pair hangs up cleanly while the other drops, both
+	// mid-conversation.
+	var wg sync.WaitGroup
+	for i := 0; i < len(conns); i += 2 {
+		x, y := conns[i], conns[i+1]
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			x.Send(client.Message{Type: "message", Text: "bye"})
+			x.Hangup()
+		}()
+		go func() {
+			defer wg.Done()
+			y.Send(client.Message{Type: "message", Text: "wait"})
+			y.Drop()
+		}()
+	}
+	wg.Wait()
+
+	// Every connection is closed by the hub, dropped ones included once
+	// nobody is left to resume to.
+	for i, c := range conns {
+		select {
+		case <-c.Closed():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("connection %d was never closed", i)
+		}
+	}
+
+	// The hub is still matching afterwards.
+	a := dial(t, h, "after")
+	b := dial(t, h, "after")
+	recv(t, a, "paired")
+	recv(t, b, "paired")
+}
+
+// wantFrom checks that msg claims to come from from.
+func wantFrom(t *testing.T, msg client.Message, from string) {
+	t.Helper()
+	if msg.From != from {
+		t.Errorf("%s message from %q, want %q", msg.Type, msg.From, from)
+	}
+}
+
+func TestFromPair(t *testing.T) {
+	h := newTestHub(t)
+	a := dial(t, h, "cats")
+	wantFrom(t, recv(t, a, "session"), client.FromServer)
+	wantFrom(t, recv(t, a, "waiting"), client.FromServer)
+	b := dial(t, h, "cats")
+	wantFrom(t, recv(t, a, "paired"), client.FromServer)
+	wantFrom(t, recv(t, b, "paired"), client.FromServer)
+
+	// Clients can't claim to be the server.
+	send(t, a, client.Message{Type: "message", From: client.FromServer, Text: "hello"})
+	wantFrom(t, recv(t, a, "sent"), client.FromServer)
+	wantFrom(t, recv(t, b, "message"), client.FromPartner)
+	send(t, b, client.Message{Type: "typing_start", From: client.FromBot})
+	wantFrom(t, recv(t, a, "typing_start"), client.FromPartner)
+
+	send(t, b, client.Message{Type: "next"})
+	wantFrom(t, recv(t, a, "partner_left"), client.FromServer)
+	send(t, a, client.Message{Type: "message", Text: "anyone?"})
+	msg := recv(t, a, "system")
+	if msg.Code != client.CodeNoPartner {
+		t.Errorf("system notice code %q, want %q", msg.Code, client.CodeNoPartner)
+	}
+	wantFrom(t, msg, client.FromServer)
+}
+
+func TestFromRoom(t *testing.T) {
+	h := newTestHub(t)
+	group := url.Values{"tag": {"cats"}, "mode": {"group"}}
+	a, err := hubtest.Dial(h, group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFrom(t, recv(t, a, "room_joined"), client.FromServer)
+	b, err := hubtest.Dial(h, group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFrom(t, recv(t, b, "room_joined"), client.FromServer)
+	wantFrom(t, recv(t, a, "member_joined"), client.FromServer)
+
+	send(t, b, client.Message{Type: "message", From: client.FromServer, Text: "hi all"})
+	wantFrom(t, recv(t, b, "sent"), client.FromServer)
+	msg := recv(t, a, "message")
+	wantFrom(t, msg, client.FromMember)
+	if msg.Name != "Cat 2" {
+		t.Errorf("room message from %q, want Cat 2", msg.Name)
+	}
+}
+
+func TestFromBot(t *testing.T) {
+	h := newTestHub(t, "-bot-after=10ms")
+	a := dial(t, h, "cats")
+	wantFrom(t, recv(t, a, "bot_paired"), client.FromServer)
+	// The reply itself only comes after a typing delay.
+	wantFrom(t, recv(t, a, "typing_start"), client.FromBot)
+}
+
+// address returns the IP address the client holding token connected from.
+func address(t *testing.T, h *hub.Hub, token string) netip.Addr {
+	t.Helper()
+	id, _, _ := strings.Cut(token, ".")
+	for _, c := range h.Snapshot().Clients {
+		if c.ID == id {
+			return netip.MustParseAddr(c.IP)
+		}
+	}
+	t.Fatalf("no client %s", id)
+	return netip.Addr{}
+}
+
+func TestBanRequeuesOnlyOutsiders(t *testing.T) {
+	h := newTestHub(t, "-admin-token=secret")
+	srv := httptest.NewServer(h.Handler())
+	defer srv.Close()
+
+	// Connect spares, each alone, until the next client starts a /30.
+	var prefix netip.Prefix
+	for i := 0; !prefix.IsValid(); i++ {
+		spare := dial(t, h, fmt.Sprintf("spare%d", i))
+		ip := address(t, h, recv(t, spare, "session").Token).As4()
+		if ip[3]%4 == 3 {
+			ip[3]++
+			prefix = netip.PrefixFrom(netip.AddrFrom4(ip), 30)
+		}
+	}
+	// a and b are paired with each other and c with d, all inside the
+	// prefix but d; w waits for the same interest as a and b.
+	a, b, _ := pair(t, h)
+	c := dial(t, h, "dogs")
+	recv(t, c, "waiting")
+	dial(t, h, "filler")
+	d := dial(t, h, "dogs")
+	if ip := address(t, h, recv(t, d, "session").Token); prefix.Contains(ip) {
+		t.Fatalf("%s is inside %s", ip, prefix)
+	}
+	recv(t, d, "paired")
+	w := dial(t, h, "cats")
+	recv(t, w, "waiting")
+
+	body := strings.NewReader(fmt.Sprintf(`{"cidr": %q, "reason": "spam"}`, prefix))
+	req, _ := http.NewRequest("POST", srv.URL+"/admin/bans", body)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("ban = %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+	for _, x := range []*hubtest.Conn{a, b, c} {
+		select {
+		case <-x.Closed():
+		case <-time.After(5 * time.Second):
+			t.Fatal("banned client still connected")
+		}
+	}
+	recv(t, d, "partner_left")
+	recv(t, d, "waiting")
+
+	// w was never matched with a banned client: the first partner it gets
+	// is a newcomer.
+	z := dial(t, h, "cats")
+	recv(t, z, "paired")
+	send(t, z, client.Message{Type: "message", Text: "hi"})
+	for {
+		msg, err := w.Recv(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == "message" {
+			break
+		}
+		if msg.Type == "partner_left" {
+			t.Fatal("w was matched with a banned client")
+		}
+	}
+}
+
+// pair connects two clients interested in cats and waits until they are
+// paired, returning a's session token too.
+func pair(t *testing.T, h *hub.Hub) (a, b *hubtest.Conn, aToken string) {
+	t.Helper()
+	a = dial(t, h, "cats")
+	aToken = recv(t, a, "session").Token
+	b = dial(t, h, "cats")
+	recv(t, a, "paired")
+	recv(t, b, "paired")
+	return a, b, aToken
+}
+
+// joinRoom connects a client to the cats group room.
+func joinRoom(t *testing.T, h *hub.Hub) *hubtest.Conn {
+	t.Helper()
+	c, err := hubtest.Dial(h, url.Values{"tag": {"cats"}, "mode": {"group"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recv(t, c, "room_joined")
+	return c
+}
+
+func TestFromEveryType(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// trigger makes the hub send a message and returns it.
+		trigger func(t *testing.T, h *hub.Hub) client.Message
+		from    string
+	}{
+		{"typing_start", func(t *testing.T, h *hub.Hub) client.Message {
+			a, b, _ := pair(t, h)
+			send(t, a, client.Message{Type: "typing_start", From: client.FromServer})
+			return recv(t, b, "typing_start")
+		}, client.FromPartner},
+		{"typing_stop", func(t *testing.T, h *hub.Hub) client.Message {
+			a, b, _ := pair(t, h)
+			send(t, a, client.Message{Type: "typing_start"})
+			send(t, a, client.Message{Type: "typing_stop", From: client.FromServer})
+			return recv(t, b, "typing_stop")
+		}, client.FromPartner},
+		{"media", func(t *testing.T, h *hub.Hub) client.Message {
+			a, b, _ := pair(t, h)
+			send(t, a, client.Message{Type: "media", From: client.FromServer, Media: &client.Media{Data: png(64)}})
+			return recv(t, b, "media")
+		}, client.FromPartner},
+		{"partner_left", func(t *testing.T, h *hub.Hub) client.Message {
+			a, b, _ := pair(t, h)
+			send(t, a, client.Message{Type: "next"})
+			return recv(t, b, "partner_left")
+		}, client.FromServer},
+		{"partner_reconnecting", func(t *testing.T, h *hub.Hub) client.Message {
+			a, b, _ := pair(t, h)
+			a.Drop()
+			return recv(t, b, "partner_reconnecting")
+		}, client.FromServer},
+		{"partner_online", func(t *testing.T, h *hub.Hub) client.Message {
+			a, b, token := pair(t, h)
+			a.Drop()
+			recv(t, b, "partner_reconnecting")
+			if _, err := hubtest.Dial(h, url.Values{"tag": {"cats"}, "resume": {token}}); err != nil {
+				t.Fatal(err)
+			}
+			return recv(t, b, "partner_online")
+		}, client.FromServer},
+		{"resumed", func(t *testing.T, h *hub.Hub) client.Message {
+			a, b, token := pair(t, h)
+			a.Drop()
+			recv(t, b, "partner_reconnecting")
+			c, err := hubtest.Dial(h, url.Values{"tag": {"cats"}, "resume": {token}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return recv(t, c, "resumed")
+		}, client.FromServer},
+		{"cooldown", func(t *testing.T, h *hub.Hub) client.Message {
+			a, _, _ := pair(t, h)
+			send(t, a, client.Message{Type: "next"})
+			recv(t, a, "waiting")
+			send(t, a, client.Message{Type: "next"})
+			return recv(t, a, "cooldown")
+		}, client.FromServer},
+		{"report saved", func(t *testing.T, h *hub.Hub) client.Message {
+			a, _, _ := pair(t, h)
+			send(t, a, client.Message{Type: "report", Reason: "rude"})
+			msg := recv(t, a, "system")
+			if msg.Code != client.CodeReportSaved {
+				t.Errorf("report ack code %q, want %q", msg.Code, client.CodeReportSaved)
+			}
+			return msg
+		}, client.FromServer},
+		{"room_joined", func(t *testing.T, h *hub.Hub) client.Message {
+			c, err := hubtest.Dial(h, url.Values{"tag": {"cats"}, "mode": {"group"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return recv(t, c, "room_joined")
+		}, client.FromServer},
+		{"member_joined", func(t *testing.T, h *hub.Hub) client.Message {
+			a := joinRoom(t, h)
+			joinRoom(t, h)
+			return recv(t, a, "member_joined")
+		}, client.FromServer},
+		{"member_left", func(t *testing.T, h *hub.Hub) client.Message {
+			a := joinRoom(t, h)
+			b := joinRoom(t, h)
+			b.Hangup()
+			return recv(t, a, "member_left")
+		}, client.FromServer},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			wantFrom(t, tc.trigger(t, newTestHub(t)), tc.from)
+		})
+	}
+}
+
+func TestRoomWithoutInterests(t *testing.T) {
+	h := newTestHub(t)
+	c, err := hubtest.Dial(h, url.Values{"mode": {"group"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room := recv(t, c, "room_joined").Data["room"]; room != "general" {
+		t.Errorf("joined room %q, want general", room)
+	}
+}
+
+// clientState returns the state the hub's snapshot shows the client with
+// id in, or "" if it is gone.
+func clientState(h *hub.Hub, id string) string {
+	for _, c := range h.Snapshot().Clients {
+		if c.ID == id {
+			return c.State
+		}
+	}
+	return ""
+}
+
+// suspendedID returns the ID of the one suspended client.
+func suspendedID(t *testing.T, h *hub.Hub) string {
+	t.Helper()
+	for _, c := range h.Snapshot().Clients {
+		if c.State == "suspended" {
+			return c.ID
+		}
+	}
+	t.Fatal("no suspended client")
+	return ""
+}
+
+func TestBreakPairSuspended(t *testing.T) {
+	for _, side := range []string{"suspended", "live"} {
+		t.Run("break from the "+side+" side", func(t *testing.T) {
+			h := newTestHub(t)
+			a := dial(t, h, "cats")
+			b := dial(t, h, "cats")
+			recv(t, a, "paired")
+			recv(t, b, "paired")
+			a.Drop()
+			recv(t, b, "partner_reconnecting")
+			dropped := suspendedID(t, h)
+
+			id := dropped
+			if side == "live" {
+				for _, c := range h.Snapshot().Clients {
+					if c.ID != dropped {
+						id = c.ID
+					}
+				}
+			}
+			if err := h.BreakPair(id); err != nil {
+				t.Fatal(err)
+			}
+			if state := clientState(h, dropped); state != "" {
+				t.Errorf("suspended client left %s, want removed", state)
+			}
+			recv(t, b, "partner_left")
+			recv(t, b, "waiting")
+			// A newcomer gets the live side, not the dropped one.
+			c := dial(t, h, "cats")
+			recv(t, c, "paired")
+			recv(t, b, "paired")
+		})
+	}
+}
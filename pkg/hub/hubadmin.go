@@ -0,0 +1,166 @@
+package hub
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Hub Inspection & Intervention ----------------------
+
+var ErrClientNotFound = errors.New("client not found")
+var ErrNotPaired = errors.New("client is not paired")
+
+// adminRequest runs fn on the hub's run loop, so it can read and change
+// pairing state like any other event.
+type adminRequest struct {
+	run func(h *Hub)
+}
+
+// do runs fn on the run loop and waits for it to finish. Once the hub has
+// shut down fn is never run.
+func (h *Hub) do(fn func()) {
+	done := make(chan struct{})
+	if post(h, h.admin, adminRequest{run: func(*Hub) {
+		fn()
+		close(done)
+	}}) {
+		<-done
+	}
+}
+
+type ClientInfo struct {
+	ID          string    `json:"id"`
+	IP          string    `json:"ip"`
+	Interests   []string  `json:"interests"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	// State is "waiting", "paired", "suspended", "room" or "idle".
+	State        string     `json:"state"`
+	WaitingSince *time.Time `json:"waitingSince,omitempty"`
+	PartnerID    string     `json:"partnerId,omitempty"`
+	// Bot is set for bot participants added with AddBot.
+	Bot bool `json:"bot,omitempty"`
+}
+
+type PairInfo struct {
+	A     string    `json:"a"`
+	B     string    `json:"b"`
+	Since time.Time `json:"since"`
+}
+
+// HubSnapshot is a point-in-time copy of the hub's state, safe to use off
+// the run loop.
+type HubSnapshot struct {
+	Clients []ClientInfo `json:"clients"`
+	// Waiting maps each interest to the IDs queued under it, longest
+	// waiting first.
+	Waiting map[string][]string `json:"waiting"`
+	Pairs   []PairInfo          `json:"pairs"`
+}
+
+func (h *Hub) Snapshot() HubSnapshot {
+	var snap HubSnapshot
+	h.do(func() {
+		snap = h.snapshot()
+	})
+	return snap
+}
+
+func (h *Hub) snapshot() HubSnapshot {
+	snap := HubSnapshot{
+		Clients: make([]ClientInfo, 0, len(h.clients)),
+		Waiting: make(map[string][]string),
+		Pairs:   []PairInfo{},
+	}
+	for c := range h.clients {
+		info := ClientInfo{
+			ID:          c.id,
+			IP:          c.ip.String(),
+			Interests:   c.interests,
+			ConnectedAt: c.createdAt,
+			State:       "idle",
+			Bot:         c.automated,
+		}
+		switch {
+		case c.room != nil:
+			info.State = "room"
+		case c.partner != nil:
+			info.State = "paired"
+			if c.suspended {
+				info.State = "suspended"
+			}
+			info.PartnerID = c.partner.id
+			if c.pairing.a == c {
+				snap.Pairs = append(snap.Pairs, PairInfo{A: c.id, B: c.partner.id, Since: c.pairing.since})
+			}
+		case h.isWaiting(c):
+			info.State = "waiting"
+			since := c.waitingSince
+			info.WaitingSince = &since
+		}
+		snap.Clients = append(snap.Clients, info)
+	}
+	for _, w := range h.waiting {
+		for _, tag := range w.interests {
+			snap.Waiting[tag] = append(snap.Waiting[tag], w.id)
+		}
+	}
+	sort.Slice(snap.Clients, func(i, j int) bool {
+		return snap.Clients[i].ConnectedAt.Before(snap.Clients[j].ConnectedAt)
+	})
+	sort.Slice(snap.Pairs, func(i, j int) bool {
+		return snap.Pairs[i].Since.Before(snap.Pairs[j].Since)
+	})
+	return snap
+}
+
+// Disconnect force-closes the client with the given session ID.
+func (h *Hub) Disconnect(id string) error {
+	err := ErrClientNotFound
+	h.do(func() {
+		c := h.clientByID(id)
+		if c == nil {
+			return
+		}
+		err = nil
+		h.kick(c, "disconnected by moderator", client.CodeKickedModerator)
+	})
+	return err
+}
+
+// BreakPair ends the pairing the given client is in and requeues both
+// sides. A side that is suspended waiting to resume is removed instead,
+// since it has no connection to be paired over.
+func (h *Hub) BreakPair(id string) error {
+	err := ErrClientNotFound
+	h.do(func() {
+		c := h.clientByID(id)
+		if c == nil {
+			return
+		}
+		if c.partner == nil {
+			err = ErrNotPaired
+			return
+		}
+		err = nil
+		h.unpair(c, client.CodePairEnded)
+		if c.suspended {
+			h.remove(c)
+			return
+		}
+		h.deliver(c, h.notice("partner_left", client.CodePairEnded, nil))
+		h.match(c)
+	})
+	return err
+}
+
+func (h *Hub) clientByID(id string) *Client {
+	for c := range h.clients {
+		if c.id == id {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+// Package hubtest provides an in-memory connection for driving a hub
+// without sockets, for tests of code built on package hub.
+package hubtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+	"github.com/Azeem01nnie/CatChat/pkg/hub"
+	"github.com/gorilla/websocket"
+)
+
+// Conn is an in-memory hub.Conn. The hub uses the hub.Conn methods;
+// whoever is playing the browser uses Send, Recv, Hangup and Drop.
+//
+// Deadlines are ignored and pings are answered at once, so a Conn only
+// closes when one side closes it. Frames the hub writes are buffered up to
+// a limit, after which its writes block until they are received.
+type Conn struct {
+	in  chan []byte
+	out chan client.Message
+
+	mu          sync.Mutex
+	limit       int64
+	pong        func(string) error
+	closeCode   int
+	closeReason string
+
+	// closed is closed when the hub closes the connection, and hungUp when
+	// the browser does, with readErr as the error the hub's reads return.
+	// What the hub writes after a Hangup is discarded, and after a Drop it
+	// fails.
+	closed    chan struct{}
+	closeOnce sync.Once
+	hungUp    chan struct{}
+	hangOnce  sync.Once
+	readErr   error
+	dropped   bool
+}
+
+var _ hub.Conn = (*Conn)(nil)
+
+// NewConn returns a connection that buffers up to buffer frames from the
+// hub.
+func NewConn(buffer int) *Conn {
+	return &Conn{
+		in:     make(chan []byte),
+		out:    make(chan client.Message, buffer),
+		closed: make(chan struct{}),
+		hungUp: make(chan struct{}),
+	}
+}
+
+// addrs numbers the addresses Dial connects from.
+var addrs atomic.Uint32
+
+// Dial connects a new Conn to h as though a browser had opened
+// /ws?query, from an address no other Dial has used so that per-address
+// limits don't get in the way. Use ServeConn directly for control over
+// the request.
+func Dial(h *hub.Hub, query url.Values) (*Conn, error) {
+	r := httptest.NewRequest("GET", "/ws?"+query.Encode(), nil)
+	n := addrs.Add(1)
+	r.RemoteAddr = fmt.Sprintf("198.18.%d.%d:40000", n>>8&0xff, n&0xff)
+	c := NewConn(256)
+	if err := h.ServeConn(c, r); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ---------------------- Browser Side ----------------------
+
+// Send sends msg to the hub as a text frame, blocking until the hub reads
+// it or either side closes the connection.
+func (c *Conn) Send(msg client.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.SendRaw(data)
+}
+
+// SendRaw sends data to the hub as a text frame as it is, which need not
+// be valid JSON.
+func (c *Conn) SendRaw(data []byte) error {
+	select {
+	case c.in <- data:
+		return nil
+	case <-c.closed:
+		return net.ErrClosed
+	case <-c.hungUp:
+		return net.ErrClosed
+	}
+}
+
+// Recv returns the next frame the hub wrote, waiting for one until ctx is
+// done. Once the hub has closed the connection and every frame has been
+// received it returns io.EOF.
+func (c *Conn) Recv(ctx context.Context) (client.Message, error) {
+	select {
+	case msg := <-c.out:
+		return msg, nil
+	case <-ctx.Done():
+		return client.Message{}, ctx.Err()
+	case <-c.closed:
+		select {
+		case msg := <-c.out:
+			return msg, nil
+		default:
+			return client.Message{}, io.EOF
+		}
+	}
+}
+
+// RecvType receives frames until one of type typ, which it returns,
+// discarding the rest.
+func (c *Conn) RecvType(ctx context.Context, typ string) (client.Message, error) {
+	for {
+		msg, err := c.Recv(ctx)
+		if err != nil || msg.Type == typ {
+			return msg, err
+		}
+	}
+}
+
+// Closed is closed once the hub has closed the connection.
+func (c *Conn) Closed() <-chan struct{} {
+	return c.closed
+}
+
+// CloseFrame returns the code and reason of the close frame the hub sent,
+// or 0 if it hasn't sent one.
+func (c *Conn) CloseFrame() (code int, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeCode, c.closeReason
+}
+
+// Hangup closes the connection from the browser's side cleanly, as when a
+// tab is closed.
+func (c *Conn) Hangup() {
+	c.hangup(&websocket.CloseError{Code: websocket.CloseGoingAway}, false)
+}
+
+// Drop closes the connection from the browser's side without a close
+// frame, as when its network goes away, which lets the session be resumed.
+func (c *Conn) Drop() {
+	c.hangup(&websocket.CloseError{Code: websocket.CloseAbnormalClosure, Text: io.ErrUnexpectedEOF.Error()}, true)
+}
+
+func (c *Conn) hangup(err error, dropped bool) {
+	c.hangOnce.Do(func() {
+		c.readErr, c.dropped = err, dropped
+		close(c.hungUp)
+	})
+}
+
+// ---------------------- Hub Side ----------------------
+
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	select {
+	case data := <-c.in:
+		c.mu.Lock()
+		limit := c.limit
+		c.mu.Unlock()
+		if limit > 0 && int64(len(data)) > limit {
+			return 0, nil, websocket.ErrReadLimit
+		}
+		return websocket.TextMessage, data, nil
+	case <-c.hungUp:
+		return 0, nil, c.readErr
+	case <-c.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (c *Conn) NextWriter(messageType int) (io.WriteCloser, error) {
+	select {
+	case <-c.closed:
+		return nil, net.ErrClosed
+	default:
+	}
+	return &frameWriter{c: c, typ: messageType}, nil
+}
+
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	discard := false
+	select {
+	case <-c.closed:
+		return net.ErrClosed
+	case <-c.hungUp:
+		if c.dropped {
+			return net.ErrClosed
+		}
+		discard = true
+	default:
+	}
+	switch messageType {
+	case websocket.TextMessage, websocket.BinaryMessage:
+		var msg client.Message
+		if err := json.Unmarshal(data, &msg); err != nil || discard {
+			return err
+		}
+		select {
+		case c.out <- msg:
+			return nil
+		case <-c.closed:
+			return net.ErrClosed
+		case <-c.hungUp:
+			return c.WriteMessage(messageType, data)
+		}
+	case websocket.CloseMessage:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.closeCode = websocket.CloseNoStatusReceived
+		if len(data) >= 2 {
+			c.closeCode = int(binary.BigEndian.Uint16(data))
+			c.closeReason = string(data[2:])
+		}
+	case websocket.PingMessage:
+		c.mu.Lock()
+		pong := c.pong
+		c.mu.Unlock()
+		if pong != nil {
+			return pong(string(data))
+		}
+	}
+	return nil
+}
+
+func (c *Conn) SetReadDeadline(time.Time) error  { return nil }
+func (c *Conn) SetWriteDeadline(time.Time) error { return nil }
+
+func (c *Conn) SetReadLimit(limit int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limit = limit
+}
+
+func (c *Conn) SetPongHandler(h func(appData string) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pong = h
+}
+
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+// frameWriter buffers a frame until it is closed, then writes it whole.
+type frameWriter struct {
+	c   *Conn
+	typ int
+	buf bytes.Buffer
+}
+
+func (w *frameWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *frameWriter) Close() error {
+	return w.c.WriteMessage(w.typ, w.buf.Bytes())
+}
@@ -0,0 +1,179 @@
+package hub
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Localisation ----------------------
+
+// Notices are rendered in the language a client asked for with ?lang= or
+// its Accept-Language header. Each locale maps notice codes to templates;
+// codes a locale lacks, and clients asking for a language nobody has
+// registered, get English.
+
+//go:embed locales/*.json
+var embeddedLocales embed.FS
+
+// defaultLang is the locale every other one falls back to.
+const defaultLang = "en"
+
+type catalog struct {
+	mu      sync.RWMutex
+	locales map[string]map[string]string
+}
+
+// newCatalog returns a catalog holding the locales shipped in locales/.
+func newCatalog() *catalog {
+	c := &catalog{locales: make(map[string]map[string]string)}
+	files, err := embeddedLocales.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range files {
+		data, err := embeddedLocales.ReadFile(path.Join("locales", f.Name()))
+		if err == nil {
+			err = c.load(strings.TrimSuffix(f.Name(), ".json"), data)
+		}
+		if err != nil {
+			panic(fmt.Sprintf("embedded locale %s: %v", f.Name(), err))
+		}
+	}
+	return c
+}
+
+// Register adds or replaces the templates for lang, a language tag such as
+// "de" or "pt-BR".
+func (c *catalog) Register(lang string, texts map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.locales[strings.ToLower(lang)] = texts
+}
+
+// LoadDir registers every <lang>.json file in dir.
+func (c *catalog) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err == nil {
+			err = c.load(strings.TrimSuffix(filepath.Base(name), ".json"), data)
+		}
+		if err != nil {
+			return fmt.Errorf("locale %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (c *catalog) load(lang string, data []byte) error {
+	var texts map[string]string
+	if err := json.Unmarshal(data, &texts); err != nil {
+		return err
+	}
+	c.Register(lang, texts)
+	return nil
+}
+
+// Text returns the template for code in lang, falling back to English.
+func (c *catalog) Text(lang, code string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if text, ok := c.locales[lang][code]; ok {
+		return text
+	}
+	return c.locales[defaultLang][code]
+}
+
+// Match picks the registered locale for a request: the lang parameter if
+// there is one for it, otherwise the best match from an Accept-Language
+// header, otherwise English. A regional tag such as "es-MX" also matches
+// the plain language.
+func (c *catalog) Match(param, acceptLanguage string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if lang, ok := c.lookup(param); ok {
+		return lang
+	}
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		if lang, ok := c.lookup(tag); ok {
+			return lang
+		}
+	}
+	return defaultLang
+}
+
+// lookup finds the locale for tag. c.mu must be held.
+func (c *catalog) lookup(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", false
+	}
+	if _, ok := c.locales[tag]; ok {
+		return tag, true
+	}
+	base, _, _ := strings.Cut(tag, "-")
+	if _, ok := c.locales[base]; ok {
+		return base, true
+	}
+	return "", false
+}
+
+// parseAcceptLanguage returns the tags in an Accept-Language header, most
+// preferred first, leaving out those with q=0.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	out := make([]string, len(tags))
+	for i, t := range tags {
+		out[i] = t.tag
+	}
+	return out
+}
+
+// RegisterLocale adds or replaces the notice templates for lang, keyed by
+// the codes in package client.
+func (h *Hub) RegisterLocale(lang string, texts map[string]string) {
+	h.catalog.Register(lang, texts)
+}
+
+// localize renders msg's notice in c's language.
+func (h *Hub) localize(c *Client, msg client.Message) client.Message {
+	if msg.Code != "" && c.lang != defaultLang {
+		msg.Text = renderNotice(h.catalog.Text(c.lang, msg.Code), msg.Data)
+	}
+	return msg
+}
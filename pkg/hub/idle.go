@@ -0,0 +1,94 @@
+package hub
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Idle and Session Limits ----------------------
+
+// With limits.IdleTimeout set, a client that sends nothing for that long
+// is disconnected, after a warning limits.IdleWarning beforehand; with
+// limits.MaxSession set, no session lasts longer than that, resumes
+// included. Either way the client is sent a timed_out message and closed
+// with CloseTimedOut, and its partner goes back into the queue. The frames
+// the frontend sends by itself, acks and stats and usage requests, aren't
+// activity.
+
+// activeFrame reports whether a frame of type typ counts as activity.
+func activeFrame(typ string) bool {
+	switch typ {
+	case "ack", "stats", "usage":
+		return false
+	}
+	return true
+}
+
+// touch records activity from c. It is called from readPump.
+func (c *Client) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+// armLimits schedules c's next idle or session check, if either limit is
+// set. It runs on the run loop.
+func (h *Hub) armLimits(c *Client) {
+	l := h.limits
+	if l.IdleTimeout == 0 && l.MaxSession == 0 {
+		return
+	}
+	var at time.Time
+	if l.IdleTimeout > 0 {
+		last := time.Unix(0, c.lastActive.Load())
+		at = last.Add(l.IdleTimeout)
+		if !c.idleWarned.After(last) {
+			at = at.Add(-l.IdleWarning)
+		}
+	}
+	if l.MaxSession > 0 {
+		if end := c.sessionStart.Add(l.MaxSession); at.IsZero() || end.Before(at) {
+			at = end
+		}
+	}
+	c.limitTimer = time.AfterFunc(time.Until(at), func() {
+		h.do(func() { h.checkLimits(c) })
+	})
+}
+
+// checkLimits warns or times out c if it has reached either limit, and
+// schedules the next check. A suspended client is checked again if it
+// resumes.
+func (h *Hub) checkLimits(c *Client) {
+	if !h.clients[c] || c.suspended {
+		return
+	}
+	l := h.limits
+	now := time.Now()
+	if l.MaxSession > 0 && !now.Before(c.sessionStart.Add(l.MaxSession)) {
+		h.timeOut(c, "session limit", client.CodeSessionLimit, l.MaxSession)
+		return
+	}
+	if l.IdleTimeout > 0 {
+		last := time.Unix(0, c.lastActive.Load())
+		idle := now.Sub(last)
+		if idle >= l.IdleTimeout {
+			h.timeOut(c, "idle", client.CodeIdleTimeout, l.IdleTimeout)
+			return
+		}
+		if idle >= l.IdleTimeout-l.IdleWarning && !c.idleWarned.After(last) {
+			c.idleWarned = now
+			left := (l.IdleTimeout - idle + time.Second - 1) / time.Second
+			h.deliver(c, h.notice("idle_warning", client.CodeIdleWarning, map[string]string{"seconds": strconv.Itoa(int(left))}))
+		}
+	}
+	h.armLimits(c)
+}
+
+// timeOut disconnects c for reaching limit, with the notice code for
+// which.
+func (h *Hub) timeOut(c *Client, reason, code string, limit time.Duration) {
+	h.metrics.timeouts.WithLabelValues(reason).Inc()
+	data := map[string]string{"minutes": strconv.Itoa(max(1, int(limit.Round(time.Minute)/time.Minute)))}
+	h.eject(c, client.CloseTimedOut, reason, h.notice("timed_out", code, data))
+}
@@ -0,0 +1,95 @@
+package hub
+
+import (
+	cryptorand "crypto/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Invites ----------------------
+
+// A client can ask for an invite code to hand to a friend, who connects
+// with ?invite=CODE and is paired with the inviter straight away instead
+// of going through the queue. A code works once, until limits.InviteTTL
+// runs out, and asking again replaces it. Codes are held by the instance
+// that issued them, so with the Redis backend the friend must reach the
+// same instance.
+
+// inviteAlphabet leaves out letters and digits that are easy to mix up
+// when a code is read out.
+const inviteAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const inviteLength = 6
+
+type invite struct {
+	// inviter is a session ID rather than a client, so an inviter that
+	// resumes its session keeps its code.
+	inviter string
+	expires time.Time
+}
+
+func newInviteCode() string {
+	b := make([]byte, inviteLength)
+	if _, err := cryptorand.Read(b); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = inviteAlphabet[int(b[i])%len(inviteAlphabet)]
+	}
+	return string(b)
+}
+
+// createInvite issues c a code, dropping any earlier one along with every
+// expired code. It runs on the run loop.
+func (h *Hub) createInvite(c *Client) {
+	if !h.clients[c] || c.challenge != nil {
+		return
+	}
+	if c.room != nil {
+		h.deliver(c, h.notice("system", client.CodeRoomNoInvite, nil))
+		return
+	}
+	now := time.Now()
+	for code, inv := range h.invites {
+		if inv.inviter == c.id || now.After(inv.expires) {
+			delete(h.invites, code)
+		}
+	}
+	code := newInviteCode()
+	for h.invites[code].inviter != "" {
+		code = newInviteCode()
+	}
+	h.invites[code] = invite{inviter: c.id, expires: now.Add(h.limits.InviteTTL)}
+	minutes := strconv.Itoa(int(h.limits.InviteTTL.Round(time.Minute) / time.Minute))
+	h.deliver(c, h.notice("invite", client.CodeInviteCreated, map[string]string{"code": code, "minutes": minutes}))
+}
+
+// redeemInvite pairs c with the client whose code it connected with,
+// ending any chat the inviter is in. If the code is unknown, used or
+// expired, or the inviter has gone, it tells c so and reports false.
+func (h *Hub) redeemInvite(c *Client) bool {
+	code := strings.ToUpper(strings.TrimSpace(c.invite))
+	inv, ok := h.invites[code]
+	delete(h.invites, code)
+	var inviter *Client
+	if ok && time.Now().Before(inv.expires) {
+		for cl := range h.clients {
+			if cl.id == inv.inviter && !cl.suspended && cl.room == nil {
+				inviter = cl
+				break
+			}
+		}
+	}
+	if inviter == nil {
+		h.deliver(c, h.notice("system", client.CodeInviteInvalid, nil))
+		return false
+	}
+	h.unpair(inviter, client.CodePartnerNext)
+	h.leave(inviter)
+	h.metrics.pairsFormed.Inc()
+	h.pair(c, inviter, sharedInterests(c.interests, inviter.interests))
+	return true
+}
@@ -0,0 +1,480 @@
+package hub
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ---------------------- Limits ----------------------
+
+// Limits collects the behavioural constants of the server in one place.
+// LoadConfig starts from DefaultLimits and applies any flags and
+// environment variables that override them.
+type Limits struct {
+	// ReadBufferSize and WriteBufferSize are the WebSocket I/O buffer
+	// sizes in bytes.
+	ReadBufferSize  int
+	WriteBufferSize int
+	// SendBuffer is the number of outbound messages queued per client.
+	SendBuffer int
+	// SendHighWater is the queue length past which a client's typing
+	// notifications and stats are dropped rather than queued.
+	SendHighWater int
+	// TimestampFormat is the Go time layout used for message timestamps,
+	// which are always in UTC.
+	TimestampFormat string
+	// NudgeAfter is how long a pairing may stay silent before it is nudged.
+	NudgeAfter time.Duration
+	// MaxInterests caps how many interests a client may list.
+	MaxInterests int
+	// AnyTagAfter is how long a client waits for a shared interest before
+	// it moves into the general pool, where it is paired with anyone.
+	AnyTagAfter time.Duration
+	// BotAfter is how long a client waits alone before a bot companion
+	// keeps it company; 0 disables the bot.
+	BotAfter time.Duration
+	// PingInterval is how often writePump pings the client.
+	PingInterval time.Duration
+	// MissedPongs is how many consecutive pongs a client may miss before
+	// its connection is treated as dead.
+	MissedPongs int
+	// WriteWait bounds each individual write to the client.
+	WriteWait time.Duration
+	// ShutdownTimeout bounds how long shutdown waits for clients to drain.
+	ShutdownTimeout time.Duration
+	// TranscriptSize is how many recent messages per pairing are kept for
+	// attaching to reports.
+	TranscriptSize int
+	// MaxReasonLength caps the runes kept from a report's reason.
+	MaxReasonLength int
+	// MaxMessageLength caps the runes in a chat message; longer ones are
+	// refused rather than cut short.
+	MaxMessageLength int
+	// MaxFrameBytes caps a single frame from a client, which must leave
+	// room for inline media and signals.
+	MaxFrameBytes int
+	// MaxSignalBytes caps the WebRTC payload of a single offer, answer or
+	// ICE candidate.
+	MaxSignalBytes int
+	// MaxMediaBytes caps the size of an upload, and MaxInlineMediaBytes
+	// that of a file sent inline in a media message.
+	MaxMediaBytes       int
+	MaxInlineMediaBytes int
+	// MediaTTL is how long an upload stays available to download.
+	MediaTTL time.Duration
+	// MediaSessionBytes caps the bytes of the uploads held for one
+	// session, and MediaStoreBytes those held in all.
+	MediaSessionBytes int
+	MediaStoreBytes   int
+	// StrikeLimit strikes against an address within StrikeWindow ban it
+	// for StrikeBan.
+	StrikeLimit  int
+	StrikeWindow time.Duration
+	StrikeBan    time.Duration
+	// RatingWindow is how long ratings count against an address. One with
+	// at least LowRatingCount of them averaging LowRatingScore or less is
+	// matched as if it had started waiting LowRatingPenalty later.
+	RatingWindow     time.Duration
+	LowRatingCount   int
+	LowRatingScore   float64
+	LowRatingPenalty time.Duration
+	// StatsInterval is how often every client is sent presence stats; 0
+	// only sends them on request.
+	StatsInterval time.Duration
+	// MaxRoomSize caps the members of a group room; further clients with
+	// the same tag get a room of their own.
+	MaxRoomSize int
+	// IdleTimeout is how long a client may send nothing before it is
+	// disconnected, IdleWarning how long before that it is warned, and
+	// MaxSession how long any session may last; see idle.go. 0 disables
+	// either limit.
+	IdleTimeout time.Duration
+	IdleWarning time.Duration
+	MaxSession  time.Duration
+	// ResumeGrace is how long a paired client that dropped off may take to
+	// reconnect and resume its chat; 0 disables resuming.
+	ResumeGrace time.Duration
+	// InviteTTL is how long an invite code can be used for.
+	InviteTTL time.Duration
+	// ChallengeBits is the proof-of-work difficulty, in leading zero bits,
+	// and ChallengeTimeout how long a new client has to pass its challenge.
+	ChallengeBits    int
+	ChallengeTimeout time.Duration
+	// RecentPartners is how many of a client's latest partners it is kept
+	// from being matched with again, until the AnyTagAfter fallback.
+	RecentPartners int
+	// TypingThrottle is the least time between relayed typing starts from
+	// one client, and TypingTimeout how long a start lasts without a stop.
+	TypingThrottle time.Duration
+	TypingTimeout  time.Duration
+	// MessageRate and TypingRate are the sustained per-second rates a
+	// client may send chat messages and typing notifications at, with
+	// bursts of up to MessageBurst and TypingBurst.
+	MessageRate  float64
+	MessageBurst int
+	TypingRate   float64
+	TypingBurst  int
+	// NextCooldown is the least time between two requeues by one client,
+	// through next or set_tag. Beyond that they are limited to RequeueRate
+	// per second, with bursts of up to RequeueBurst.
+	NextCooldown time.Duration
+	RequeueRate  float64
+	RequeueBurst int
+	// FloodRepeats, FloodMaxLines, FloodBurst and FloodWindow define
+	// flooding; see flood.go. A second offence mutes a client for
+	// FloodMute, and offences are forgotten after FloodForget.
+	FloodRepeats  int
+	FloodMaxLines int
+	FloodBurst    int
+	FloodWindow   time.Duration
+	FloodMute     time.Duration
+	FloodForget   time.Duration
+	// MaxRateViolations is how many throttled frames a client may send
+	// within RateViolationWindow before it is disconnected.
+	MaxRateViolations   int
+	RateViolationWindow time.Duration
+	// BackendTimeout bounds each call to the hub backend, StoreTimeout
+	// each save to the report or ban store, and MediaCheckTimeout each
+	// moderation check of a file sent inline.
+	BackendTimeout    time.Duration
+	StoreTimeout      time.Duration
+	MediaCheckTimeout time.Duration
+	// BotHistory caps the lines of a conversation passed to a bot
+	// companion's responder, BotInbox how many unanswered lines from the
+	// client are held (the cat ignores the rest), and BotRespondTimeout
+	// bounds a single reply.
+	BotHistory        int
+	BotInbox          int
+	BotRespondTimeout time.Duration
+	// BotSendBuffer is the number of messages queued for a bot added with
+	// AddBot; one that falls that far behind is disconnected.
+	BotSendBuffer int
+	// ObserverBuffer is how many messages a moderator observing a pair may
+	// fall behind by before it is dropped.
+	ObserverBuffer int
+	// ChallengeVerifyTimeout bounds a single check of a challenge answer.
+	ChallengeVerifyTimeout time.Duration
+	// WebhookQueueSize events may wait for delivery before more are
+	// dropped. Each request is bounded by WebhookTimeout and made up to
+	// WebhookAttempts times, waiting WebhookBackoff before the first retry
+	// and twice as long before each after it. OverloadNoticeEvery bounds
+	// how often server_overloaded is sent while connections keep being
+	// turned away.
+	WebhookQueueSize    int
+	WebhookTimeout      time.Duration
+	WebhookAttempts     int
+	WebhookBackoff      time.Duration
+	OverloadNoticeEvery time.Duration
+}
+
+// DefaultLimits returns the limits the server runs with when no flag or
+// environment variable says otherwise. They pass Validate.
+func DefaultLimits() Limits {
+	return Limits{
+		ReadBufferSize:      1024,
+		WriteBufferSize:     1024,
+		SendBuffer:          16,
+		SendHighWater:       12,
+		TimestampFormat:     time.RFC3339,
+		NudgeAfter:          45 * time.Second,
+		MaxInterests:        10,
+		AnyTagAfter:         30 * time.Second,
+		PingInterval:        30 * time.Second,
+		MissedPongs:         2,
+		WriteWait:           10 * time.Second,
+		ShutdownTimeout:     15 * time.Second,
+		TranscriptSize:      20,
+		MaxReasonLength:     500,
+		MaxMessageLength:    2000,
+		MaxFrameBytes:       128 << 10,
+		MaxSignalBytes:      16 << 10,
+		RecentPartners:      3,
+		ResumeGrace:         15 * time.Second,
+		IdleWarning:         time.Minute,
+		InviteTTL:           10 * time.Minute,
+		ChallengeBits:       16,
+		ChallengeTimeout:    2 * time.Minute,
+		MaxRoomSize:         8,
+		StatsInterval:       30 * time.Second,
+		RatingWindow:        7 * 24 * time.Hour,
+		LowRatingCount:      5,
+		LowRatingScore:      2,
+		LowRatingPenalty:    20 * time.Second,
+		StrikeLimit:         3,
+		StrikeWindow:        24 * time.Hour,
+		StrikeBan:           24 * time.Hour,
+		MaxMediaBytes:       5 << 20,
+		MaxInlineMediaBytes: 64 << 10,
+		MediaTTL:            10 * time.Minute,
+		MediaSessionBytes:   20 << 20,
+		MediaStoreBytes:     512 << 20,
+		MessageRate:         2,
+		MessageBurst:        5,
+		TypingRate:          2,
+		TypingThrottle:      3 * time.Second,
+		TypingTimeout:       5 * time.Second,
+		TypingBurst:         5,
+		NextCooldown:        3 * time.Second,
+		RequeueRate:         0.1,
+		RequeueBurst:        5,
+		FloodRepeats:        3,
+		FloodMaxLines:       10,
+		FloodBurst:          8,
+		FloodWindow:         10 * time.Second,
+		FloodMute:           30 * time.Second,
+		FloodForget:         5 * time.Minute,
+		MaxRateViolations:   10,
+		RateViolationWindow: 10 * time.Second,
+
+		BackendTimeout:         2 * time.Second,
+		StoreTimeout:           5 * time.Second,
+		MediaCheckTimeout:      5 * time.Second,
+		BotHistory:             20,
+		BotInbox:               4,
+		BotRespondTimeout:      15 * time.Second,
+		BotSendBuffer:          256,
+		ObserverBuffer:         64,
+		ChallengeVerifyTimeout: 10 * time.Second,
+		WebhookQueueSize:       256,
+		WebhookTimeout:         5 * time.Second,
+		WebhookAttempts:        4,
+		WebhookBackoff:         time.Second,
+		OverloadNoticeEvery:    time.Minute,
+	}
+}
+
+// Validate reports every inconsistent field at once.
+func (l Limits) Validate() error {
+	var errs []error
+	if l.ReadBufferSize <= 0 {
+		errs = append(errs, fmt.Errorf("ReadBufferSize must be positive, got %d", l.ReadBufferSize))
+	}
+	if l.WriteBufferSize <= 0 {
+		errs = append(errs, fmt.Errorf("WriteBufferSize must be positive, got %d", l.WriteBufferSize))
+	}
+	if l.SendBuffer < 1 {
+		errs = append(errs, fmt.Errorf("SendBuffer must be at least 1, got %d", l.SendBuffer))
+	}
+	if l.SendHighWater < 1 || l.SendHighWater > l.SendBuffer {
+		errs = append(errs, fmt.Errorf("SendHighWater must be between 1 and SendBuffer (%d), got %d", l.SendBuffer, l.SendHighWater))
+	}
+	if l.TimestampFormat == "" {
+		errs = append(errs, errors.New("TimestampFormat must not be empty"))
+	} else if time.Unix(0, 0).Format(l.TimestampFormat) == time.Unix(86399, 0).Format(l.TimestampFormat) {
+		errs = append(errs, fmt.Errorf("TimestampFormat %q contains no time fields", l.TimestampFormat))
+	}
+	if l.NudgeAfter <= 0 {
+		errs = append(errs, fmt.Errorf("NudgeAfter must be positive, got %s", l.NudgeAfter))
+	}
+	if l.MaxInterests < 1 {
+		errs = append(errs, fmt.Errorf("MaxInterests must be at least 1, got %d", l.MaxInterests))
+	}
+	if l.AnyTagAfter <= 0 {
+		errs = append(errs, fmt.Errorf("AnyTagAfter must be positive, got %s", l.AnyTagAfter))
+	}
+	if l.BotAfter < 0 {
+		errs = append(errs, fmt.Errorf("BotAfter must not be negative, got %s", l.BotAfter))
+	}
+	if l.PingInterval <= 0 {
+		errs = append(errs, fmt.Errorf("PingInterval must be positive, got %s", l.PingInterval))
+	}
+	if l.MissedPongs < 1 {
+		errs = append(errs, fmt.Errorf("MissedPongs must be at least 1, got %d", l.MissedPongs))
+	}
+	if l.WriteWait <= 0 {
+		errs = append(errs, fmt.Errorf("WriteWait must be positive, got %s", l.WriteWait))
+	} else if l.WriteWait >= l.PingInterval {
+		errs = append(errs, fmt.Errorf("WriteWait (%s) must be shorter than PingInterval (%s), or a stalled ping would overlap the next one", l.WriteWait, l.PingInterval))
+	}
+	if l.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("ShutdownTimeout must be positive, got %s", l.ShutdownTimeout))
+	} else if l.ShutdownTimeout <= l.WriteWait {
+		errs = append(errs, fmt.Errorf("ShutdownTimeout (%s) must exceed WriteWait (%s) so a final write can finish", l.ShutdownTimeout, l.WriteWait))
+	}
+	if l.TranscriptSize < 1 {
+		errs = append(errs, fmt.Errorf("TranscriptSize must be at least 1, got %d", l.TranscriptSize))
+	}
+	if l.MaxReasonLength < 1 {
+		errs = append(errs, fmt.Errorf("MaxReasonLength must be at least 1, got %d", l.MaxReasonLength))
+	}
+	if l.MaxSignalBytes < 1 {
+		errs = append(errs, fmt.Errorf("MaxSignalBytes must be at least 1, got %d", l.MaxSignalBytes))
+	}
+	if l.MaxMessageLength < 1 {
+		errs = append(errs, fmt.Errorf("MaxMessageLength must be at least 1, got %d", l.MaxMessageLength))
+	}
+	if l.MaxMediaBytes < 1 {
+		errs = append(errs, fmt.Errorf("MaxMediaBytes must be at least 1, got %d", l.MaxMediaBytes))
+	}
+	if l.MaxInlineMediaBytes < 0 || l.MaxInlineMediaBytes > l.MaxMediaBytes {
+		errs = append(errs, fmt.Errorf("MaxInlineMediaBytes must be between 0 and MaxMediaBytes (%d), got %d", l.MaxMediaBytes, l.MaxInlineMediaBytes))
+	}
+	// Inline media travels base64-encoded, and a frame needs some room
+	// beyond its payload for the rest of the message.
+	if need := max(base64.StdEncoding.EncodedLen(l.MaxInlineMediaBytes), l.MaxSignalBytes, 4*l.MaxMessageLength) + 1<<10; l.MaxFrameBytes < need {
+		errs = append(errs, fmt.Errorf("MaxFrameBytes must be at least %d to fit inline media, signals and messages, got %d", need, l.MaxFrameBytes))
+	}
+	if l.MediaTTL <= 0 {
+		errs = append(errs, fmt.Errorf("MediaTTL must be positive, got %s", l.MediaTTL))
+	}
+	if l.MediaSessionBytes < l.MaxMediaBytes {
+		errs = append(errs, fmt.Errorf("MediaSessionBytes must be at least MaxMediaBytes (%d), got %d", l.MaxMediaBytes, l.MediaSessionBytes))
+	}
+	if l.MediaStoreBytes < l.MediaSessionBytes {
+		errs = append(errs, fmt.Errorf("MediaStoreBytes must be at least MediaSessionBytes (%d), got %d", l.MediaSessionBytes, l.MediaStoreBytes))
+	}
+	if l.StrikeLimit < 1 {
+		errs = append(errs, fmt.Errorf("StrikeLimit must be at least 1, got %d", l.StrikeLimit))
+	}
+	if l.StrikeWindow <= 0 {
+		errs = append(errs, fmt.Errorf("StrikeWindow must be positive, got %s", l.StrikeWindow))
+	}
+	if l.StrikeBan <= 0 {
+		errs = append(errs, fmt.Errorf("StrikeBan must be positive, got %s", l.StrikeBan))
+	}
+	if l.StatsInterval < 0 {
+		errs = append(errs, fmt.Errorf("StatsInterval must not be negative, got %s", l.StatsInterval))
+	}
+	if l.RatingWindow <= 0 {
+		errs = append(errs, fmt.Errorf("RatingWindow must be positive, got %s", l.RatingWindow))
+	}
+	if l.LowRatingCount < 1 {
+		errs = append(errs, fmt.Errorf("LowRatingCount must be at least 1, got %d", l.LowRatingCount))
+	}
+	if l.LowRatingPenalty < 0 {
+		errs = append(errs, fmt.Errorf("LowRatingPenalty must not be negative, got %s", l.LowRatingPenalty))
+	}
+	if l.MaxRoomSize < 2 {
+		errs = append(errs, fmt.Errorf("MaxRoomSize must be at least 2, got %d", l.MaxRoomSize))
+	}
+	if l.InviteTTL < time.Minute {
+		errs = append(errs, fmt.Errorf("InviteTTL must be at least a minute, got %s", l.InviteTTL))
+	}
+	if l.ChallengeBits < 1 || l.ChallengeBits > 32 {
+		errs = append(errs, fmt.Errorf("ChallengeBits must be between 1 and 32, got %d", l.ChallengeBits))
+	}
+	if l.ChallengeTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("ChallengeTimeout must be positive, got %s", l.ChallengeTimeout))
+	}
+	if l.IdleTimeout < 0 {
+		errs = append(errs, fmt.Errorf("IdleTimeout must not be negative, got %s", l.IdleTimeout))
+	} else if l.IdleTimeout > 0 && (l.IdleWarning <= 0 || l.IdleWarning >= l.IdleTimeout) {
+		errs = append(errs, fmt.Errorf("IdleWarning must be positive and shorter than IdleTimeout (%s), got %s", l.IdleTimeout, l.IdleWarning))
+	}
+	if l.MaxSession < 0 {
+		errs = append(errs, fmt.Errorf("MaxSession must not be negative, got %s", l.MaxSession))
+	}
+	if l.ResumeGrace < 0 {
+		errs = append(errs, fmt.Errorf("ResumeGrace must not be negative, got %s", l.ResumeGrace))
+	}
+	if l.RecentPartners < 0 {
+		errs = append(errs, fmt.Errorf("RecentPartners must not be negative, got %d", l.RecentPartners))
+	}
+	if l.MessageRate <= 0 {
+		errs = append(errs, fmt.Errorf("MessageRate must be positive, got %g", l.MessageRate))
+	}
+	if l.MessageBurst < 1 {
+		errs = append(errs, fmt.Errorf("MessageBurst must be at least 1, got %d", l.MessageBurst))
+	}
+	if l.TypingThrottle < 0 {
+		errs = append(errs, fmt.Errorf("TypingThrottle must not be negative, got %s", l.TypingThrottle))
+	}
+	if l.TypingTimeout <= l.TypingThrottle {
+		errs = append(errs, fmt.Errorf("TypingTimeout must be longer than TypingThrottle (%s), got %s", l.TypingThrottle, l.TypingTimeout))
+	}
+	if l.TypingRate <= 0 {
+		errs = append(errs, fmt.Errorf("TypingRate must be positive, got %g", l.TypingRate))
+	}
+	if l.TypingBurst < 1 {
+		errs = append(errs, fmt.Errorf("TypingBurst must be at least 1, got %d", l.TypingBurst))
+	}
+	if l.NextCooldown < 0 {
+		errs = append(errs, fmt.Errorf("NextCooldown must not be negative, got %s", l.NextCooldown))
+	}
+	if l.RequeueRate <= 0 {
+		errs = append(errs, fmt.Errorf("RequeueRate must be positive, got %g", l.RequeueRate))
+	}
+	if l.RequeueBurst < 1 {
+		errs = append(errs, fmt.Errorf("RequeueBurst must be at least 1, got %d", l.RequeueBurst))
+	}
+	if l.FloodRepeats < 2 {
+		errs = append(errs, fmt.Errorf("FloodRepeats must be at least 2, got %d", l.FloodRepeats))
+	}
+	if l.FloodMaxLines < 1 {
+		errs = append(errs, fmt.Errorf("FloodMaxLines must be at least 1, got %d", l.FloodMaxLines))
+	}
+	if l.FloodBurst < 1 {
+		errs = append(errs, fmt.Errorf("FloodBurst must be at least 1, got %d", l.FloodBurst))
+	}
+	if l.FloodWindow <= 0 {
+		errs = append(errs, fmt.Errorf("FloodWindow must be positive, got %s", l.FloodWindow))
+	}
+	if l.FloodMute <= 0 {
+		errs = append(errs, fmt.Errorf("FloodMute must be positive, got %s", l.FloodMute))
+	}
+	if l.FloodForget < l.FloodMute {
+		errs = append(errs, fmt.Errorf("FloodForget must be at least FloodMute (%s), got %s", l.FloodMute, l.FloodForget))
+	}
+	if l.MaxRateViolations < 0 {
+		errs = append(errs, fmt.Errorf("MaxRateViolations must not be negative, got %d", l.MaxRateViolations))
+	}
+	if l.RateViolationWindow <= 0 {
+		errs = append(errs, fmt.Errorf("RateViolationWindow must be positive, got %s", l.RateViolationWindow))
+	}
+	// Backend calls block the run loop, so one must not outlast a
+	// shutdown.
+	if l.BackendTimeout <= 0 || l.BackendTimeout >= l.ShutdownTimeout {
+		errs = append(errs, fmt.Errorf("BackendTimeout must be positive and shorter than ShutdownTimeout (%s), got %s", l.ShutdownTimeout, l.BackendTimeout))
+	}
+	if l.StoreTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("StoreTimeout must be positive, got %s", l.StoreTimeout))
+	}
+	if l.MediaCheckTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("MediaCheckTimeout must be positive, got %s", l.MediaCheckTimeout))
+	}
+	if l.BotHistory < 1 {
+		errs = append(errs, fmt.Errorf("BotHistory must be at least 1, got %d", l.BotHistory))
+	}
+	if l.BotInbox < 1 {
+		errs = append(errs, fmt.Errorf("BotInbox must be at least 1, got %d", l.BotInbox))
+	}
+	if l.BotRespondTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("BotRespondTimeout must be positive, got %s", l.BotRespondTimeout))
+	}
+	if l.BotSendBuffer < 1 {
+		errs = append(errs, fmt.Errorf("BotSendBuffer must be at least 1, got %d", l.BotSendBuffer))
+	}
+	if l.ObserverBuffer < 1 {
+		errs = append(errs, fmt.Errorf("ObserverBuffer must be at least 1, got %d", l.ObserverBuffer))
+	}
+	// An answer still being checked when the challenge runs out would be
+	// thrown away.
+	if l.ChallengeVerifyTimeout <= 0 || l.ChallengeVerifyTimeout >= l.ChallengeTimeout {
+		errs = append(errs, fmt.Errorf("ChallengeVerifyTimeout must be positive and shorter than ChallengeTimeout (%s), got %s", l.ChallengeTimeout, l.ChallengeVerifyTimeout))
+	}
+	if l.WebhookQueueSize < 1 {
+		errs = append(errs, fmt.Errorf("WebhookQueueSize must be at least 1, got %d", l.WebhookQueueSize))
+	}
+	if l.WebhookTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("WebhookTimeout must be positive, got %s", l.WebhookTimeout))
+	}
+	if l.WebhookAttempts < 1 {
+		errs = append(errs, fmt.Errorf("WebhookAttempts must be at least 1, got %d", l.WebhookAttempts))
+	}
+	if l.WebhookBackoff < 0 {
+		errs = append(errs, fmt.Errorf("WebhookBackoff must not be negative, got %s", l.WebhookBackoff))
+	}
+	if l.OverloadNoticeEvery <= 0 {
+		errs = append(errs, fmt.Errorf("OverloadNoticeEvery must be positive, got %s", l.OverloadNoticeEvery))
+	}
+	return errors.Join(errs...)
+}
+
+// PongWait is how long readPump waits for any pong before giving up on the
+// connection: MissedPongs ping intervals plus time for the last ping's
+// write to complete.
+func (l Limits) PongWait() time.Duration {
+	return time.Duration(l.MissedPongs)*l.PingInterval + l.WriteWait
+}
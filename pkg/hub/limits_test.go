@@ -0,0 +1,72 @@
+package hub
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultLimitsValid(t *testing.T) {
+	if err := DefaultLimits().Validate(); err != nil {
+		t.Fatalf("DefaultLimits().Validate() = %v", err)
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		modify func(*Limits)
+		want   string
+	}{
+		{"no send buffer", func(l *Limits) { l.SendBuffer, l.SendHighWater = 0, 0 }, "SendBuffer must be at least 1"},
+		{"high water past buffer", func(l *Limits) { l.SendHighWater = l.SendBuffer + 1 }, "SendHighWater must be between 1 and SendBuffer"},
+		{"empty timestamp format", func(l *Limits) { l.TimestampFormat = "" }, "TimestampFormat must not be empty"},
+		{"date-only timestamp format", func(l *Limits) { l.TimestampFormat = "2006-01-02" }, "contains no time fields"},
+		{"write wait past ping interval", func(l *Limits) { l.WriteWait = l.PingInterval }, "WriteWait (30s) must be shorter than PingInterval"},
+		{"shutdown within write wait", func(l *Limits) { l.ShutdownTimeout = l.WriteWait }, "ShutdownTimeout (10s) must exceed WriteWait"},
+		{"inline media past max media", func(l *Limits) { l.MaxInlineMediaBytes = l.MaxMediaBytes + 1 }, "MaxInlineMediaBytes must be between 0 and MaxMediaBytes"},
+		{"frame too small for inline media", func(l *Limits) { l.MaxFrameBytes = l.MaxInlineMediaBytes }, "MaxFrameBytes must be at least"},
+		{"session media under max media", func(l *Limits) { l.MediaSessionBytes = l.MaxMediaBytes - 1 }, "MediaSessionBytes must be at least MaxMediaBytes"},
+		{"store media under session media", func(l *Limits) { l.MediaStoreBytes = l.MediaSessionBytes - 1 }, "MediaStoreBytes must be at least MediaSessionBytes"},
+		{"idle warning past idle timeout", func(l *Limits) { l.IdleTimeout, l.IdleWarning = time.Minute, time.Minute }, "IdleWarning must be positive and shorter than IdleTimeout"},
+		{"typing timeout within throttle", func(l *Limits) { l.TypingTimeout = l.TypingThrottle }, "TypingTimeout must be longer than TypingThrottle"},
+		{"flood forget before mute", func(l *Limits) { l.FloodForget = l.FloodMute - time.Second }, "FloodForget must be at least FloodMute"},
+		{"single repeat is a flood", func(l *Limits) { l.FloodRepeats = 1 }, "FloodRepeats must be at least 2"},
+		{"one-person room", func(l *Limits) { l.MaxRoomSize = 1 }, "MaxRoomSize must be at least 2"},
+		{"short invites", func(l *Limits) { l.InviteTTL = time.Second }, "InviteTTL must be at least a minute"},
+		{"challenge too hard", func(l *Limits) { l.ChallengeBits = 33 }, "ChallengeBits must be between 1 and 32"},
+		{"backend outlasts shutdown", func(l *Limits) { l.BackendTimeout = l.ShutdownTimeout }, "BackendTimeout must be positive and shorter than ShutdownTimeout"},
+		{"verify outlasts challenge", func(l *Limits) { l.ChallengeVerifyTimeout = l.ChallengeTimeout }, "ChallengeVerifyTimeout must be positive and shorter than ChallengeTimeout"},
+		{"no bot inbox", func(l *Limits) { l.BotInbox = 0 }, "BotInbox must be at least 1"},
+		{"no webhook attempts", func(l *Limits) { l.WebhookAttempts = 0 }, "WebhookAttempts must be at least 1"},
+		{"negative webhook backoff", func(l *Limits) { l.WebhookBackoff = -time.Second }, "WebhookBackoff must not be negative"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := DefaultLimits()
+			tc.modify(&l)
+			err := l.Validate()
+			if err == nil {
+				t.Fatalf("Validate() = nil, want %q", tc.want)
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Validate() = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryField(t *testing.T) {
+	l := DefaultLimits()
+	l.MaxInterests = 0
+	l.MessageRate = 0
+	l.MaxRoomSize = 0
+	err := l.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil")
+	}
+	for _, want := range []string{"MaxInterests", "MessageRate", "MaxRoomSize"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, missing %s", err, want)
+		}
+	}
+}
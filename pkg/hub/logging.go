@@ -0,0 +1,52 @@
+package hub
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// ---------------------- Logging ----------------------
+
+// Logs are structured so they can be queried once aggregated. Every
+// connection gets a short ID when it is upgraded, logged as "conn" on
+// everything to do with it; unlike the session ID it is never sent to
+// anyone, and a resumed session gets a new one.
+
+// newLogger returns a logger writing to w in format, "text" or "json", at
+// level and above.
+func newLogger(w io.Writer, format string, level slog.Level) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// Logger returns a logger writing to w in the configured format, at the
+// configured level and above.
+func (c Config) Logger(w io.Writer) *slog.Logger {
+	// Validate has already rejected a bad level.
+	level, _ := parseLogLevel(c.LogLevel)
+	return newLogger(w, c.LogFormat, level)
+}
+
+// parseLogLevel accepts "debug", "info", "warn" or "error".
+func parseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("log-level: %w", err)
+	}
+	return level, nil
+}
+
+// newConnID returns a random ID for logging a connection under.
+func newConnID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
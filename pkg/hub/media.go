@@ -0,0 +1,284 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Media Sharing ----------------------
+
+// Clients share images and files with media messages. Small ones carry
+// their bytes inline; anything bigger is POSTed to /upload first, which
+// keeps it in memory for limits.MediaTTL and hands back a /media/ URL to
+// send instead. Only a connected client with a partner or a room may
+// upload, and uploads held at once are capped per session and in total.
+// Uploads are held by the instance that accepted them, so with the Redis
+// backend /media/ must be routed to the same instance as /upload.
+
+// MediaModerator looks at every shared file before it reaches a partner.
+// Returning an error rejects the file.
+type MediaModerator interface {
+	Moderate(ctx context.Context, contentType string, data []byte) error
+}
+
+// SetMediaModerator makes m vet every shared file, inline or uploaded,
+// instead of accepting all that the size and type limits let through. It
+// must be called before the hub starts serving.
+func (h *Hub) SetMediaModerator(m MediaModerator) {
+	h.media.moderator = m
+}
+
+// allowAllMedia is the default moderator: it accepts everything the size
+// and type limits let through.
+type allowAllMedia struct{}
+
+func (allowAllMedia) Moderate(ctx context.Context, contentType string, data []byte) error {
+	return nil
+}
+
+// mediaPath is where uploads are served from.
+const mediaPath = "/media/"
+
+var (
+	errMediaTooLarge = errors.New("file too large")
+	errMediaType     = errors.New("file type not allowed")
+	errMediaRejected = errors.New("rejected by moderation")
+	errMediaGone     = errors.New("upload expired or not found")
+	errMediaQuota    = errors.New("too many uploads held for this session")
+	errMediaFull     = errors.New("no room for more uploads")
+)
+
+// mediaNoticeCode is the notice telling a client why check refused its
+// file.
+func mediaNoticeCode(err error) string {
+	switch {
+	case errors.Is(err, errMediaTooLarge):
+		return client.CodeMediaTooLarge
+	case errors.Is(err, errMediaType):
+		return client.CodeMediaType
+	case errors.Is(err, errMediaGone):
+		return client.CodeMediaGone
+	}
+	return client.CodeMediaRejected
+}
+
+type upload struct {
+	// session is the uploader's session ID.
+	session     string
+	contentType string
+	data        []byte
+	expires     time.Time
+}
+
+type mediaStore struct {
+	limits    Limits
+	types     []string
+	moderator MediaModerator
+
+	mu      sync.Mutex
+	uploads map[string]*upload
+	// held counts the bytes of unexpired uploads, in all and per session.
+	held        int
+	heldSession map[string]int
+}
+
+func newMediaStore(limits Limits, types []string) *mediaStore {
+	return &mediaStore{
+		limits:      limits,
+		types:       types,
+		moderator:   allowAllMedia{},
+		uploads:     make(map[string]*upload),
+		heldSession: make(map[string]int),
+	}
+}
+
+// check vets m before it is relayed, detecting the type of inline data
+// and filling in the type of an upload its URL points at.
+func (s *mediaStore) check(ctx context.Context, m *client.Media) error {
+	if m.URL != "" {
+		id, ok := strings.CutPrefix(m.URL, mediaPath)
+		u := s.get(id)
+		if !ok || u == nil {
+			return errMediaGone
+		}
+		m.Data, m.Type = nil, u.contentType
+		return nil
+	}
+	if len(m.Data) > s.limits.MaxInlineMediaBytes {
+		return errMediaTooLarge
+	}
+	contentType, err := s.vet(ctx, m.Data)
+	m.Type = contentType
+	return err
+}
+
+// vet checks data against the type allowlist and the moderator, returning
+// its detected MIME type.
+func (s *mediaStore) vet(ctx context.Context, data []byte) (string, error) {
+	contentType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	allowed := false
+	for _, t := range s.types {
+		if t == contentType {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return contentType, errMediaType
+	}
+	if err := s.moderator.Moderate(ctx, contentType, data); err != nil {
+		slog.Info("media rejected by moderation", "type", contentType, "err", err)
+		return contentType, errMediaRejected
+	}
+	return contentType, nil
+}
+
+// put stores an upload from session, unless it would take the bytes held
+// for the session past limits.MediaSessionBytes or those held in all past
+// limits.MediaStoreBytes.
+func (s *mediaStore) put(session, contentType string, data []byte) (string, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, u := range s.uploads {
+		if now.After(u.expires) {
+			s.drop(id, u)
+		}
+	}
+	if s.heldSession[session]+len(data) > s.limits.MediaSessionBytes {
+		return "", time.Time{}, errMediaQuota
+	}
+	if s.held+len(data) > s.limits.MediaStoreBytes {
+		return "", time.Time{}, errMediaFull
+	}
+	id := newSessionID() + newSessionID()
+	expires := now.Add(s.limits.MediaTTL)
+	s.uploads[id] = &upload{session: session, contentType: contentType, data: data, expires: expires}
+	s.held += len(data)
+	s.heldSession[session] += len(data)
+	return id, expires, nil
+}
+
+// drop forgets an upload. s.mu must be held.
+func (s *mediaStore) drop(id string, u *upload) {
+	delete(s.uploads, id)
+	s.held -= len(u.data)
+	if s.heldSession[u.session] -= len(u.data); s.heldSession[u.session] <= 0 {
+		delete(s.heldSession, u.session)
+	}
+}
+
+func (s *mediaStore) get(id string) *upload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.uploads[id]
+	if u == nil || time.Now().After(u.expires) {
+		return nil
+	}
+	return u
+}
+
+type uploadResponse struct {
+	URL     string    `json:"url"`
+	Type    string    `json:"type"`
+	Expires time.Time `json:"expires"`
+}
+
+// handleUpload serves POST /upload. The request must carry the uploader's
+// session token in X-CatChat-Session, for a session that is connected and
+// has a partner or a room, and the body is the raw file.
+func (h *Hub) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	if _, banned := h.bans.Check(h.clientIP(r)); banned {
+		http.Error(w, "banned", http.StatusForbidden)
+		return
+	}
+	session, ok := h.verifySessionToken(r.Header.Get("X-CatChat-Session"))
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var live, chatting bool
+	h.do(func() {
+		c := h.clientByID(session)
+		live = c != nil && !c.suspended
+		chatting = live && (c.partner != nil || c.room != nil)
+	})
+	if !live {
+		http.Error(w, "session ended", http.StatusUnauthorized)
+		return
+	}
+	if !chatting {
+		http.Error(w, "not in a chat", http.StatusForbidden)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(h.limits.MaxMediaBytes)))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, errMediaTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "reading upload", http.StatusBadRequest)
+		return
+	}
+	contentType, err := h.media.vet(r.Context(), data)
+	switch {
+	case errors.Is(err, errMediaType):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	id, expires, err := h.media.put(session, contentType, data)
+	switch {
+	case errors.Is(err, errMediaQuota):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+	writeJSON(w, http.StatusCreated, uploadResponse{URL: mediaPath + id, Type: contentType, Expires: expires})
+}
+
+// rasterImage reports whether t is an image type browsers only ever
+// display. SVG is an image type but can carry script.
+func rasterImage(t string) bool {
+	return strings.HasPrefix(t, "image/") && t != "image/svg+xml"
+}
+
+// handleMedia serves GET /media/<id> until the upload expires.
+func (h *Hub) handleMedia(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	u := h.media.get(strings.TrimPrefix(r.URL.Path, mediaPath))
+	if u == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", u.contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, no-store")
+	if rasterImage(u.contentType) {
+		w.Header().Set("Content-Disposition", "inline")
+	} else {
+		// Config.Validate keeps these out, but never let an upload run
+		// script on our origin.
+		w.Header().Set("Content-Disposition", "attachment")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	}
+	w.Write(u.data)
+}
@@ -0,0 +1,197 @@
+package hub_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/hub"
+	"github.com/Azeem01nnie/CatChat/pkg/hub/hubtest"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// png is n bytes that sniff as image/png.
+func png(n int) []byte {
+	return append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, n-8)...)
+}
+
+// upload POSTs data to /upload as the session token identifies, returning
+// the status code.
+func upload(t *testing.T, srv *httptest.Server, token string, data []byte) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/upload", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-CatChat-Session", token)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+type rejectMedia struct{}
+
+func (rejectMedia) Moderate(context.Context, string, []byte) error {
+	return errors.New("no")
+}
+
+func TestUploadNeedsLiveChat(t *testing.T) {
+	h := newTestHub(t)
+	srv := httptest.NewServer(h.Handler())
+	defer srv.Close()
+
+	a := dial(t, h, "cats")
+	token := recv(t, a, "session").Token
+	recv(t, a, "waiting")
+	if code := upload(t, srv, token, png(100)); code != http.StatusForbidden {
+		t.Errorf("upload while waiting = %d, want %d", code, http.StatusForbidden)
+	}
+
+	b := dial(t, h, "cats")
+	recv(t, a, "paired")
+	recv(t, b, "paired")
+	if code := upload(t, srv, token, png(100)); code != http.StatusCreated {
+		t.Errorf("upload while paired = %d, want %d", code, http.StatusCreated)
+	}
+
+	a.Hangup()
+	<-a.Closed()
+	recv(t, b, "partner_left")
+	if code := upload(t, srv, token, png(100)); code != http.StatusUnauthorized {
+		t.Errorf("upload after hanging up = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := upload(t, srv, "bogus", png(100)); code != http.StatusUnauthorized {
+		t.Errorf("upload with a bad token = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestUploadQuotas(t *testing.T) {
+	h := newTestHub(t,
+		"-max-media-bytes=2048", "-max-inline-media-bytes=1024",
+		"-media-session-bytes=3000", "-media-store-bytes=5000")
+	srv := httptest.NewServer(h.Handler())
+	defer srv.Close()
+
+	a := dial(t, h, "cats")
+	aToken := recv(t, a, "session").Token
+	b := dial(t, h, "cats")
+	bToken := recv(t, b, "session").Token
+	for _, c := range []*hubtest.Conn{a, b} {
+		recv(t, c, "paired")
+	}
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"first", aToken, http.StatusCreated},
+		{"up to the session cap", aToken, http.StatusCreated},
+		{"past the session cap", aToken, http.StatusTooManyRequests},
+		{"partner's first", bToken, http.StatusCreated},
+		{"past the store cap", bToken, http.StatusInsufficientStorage},
+	} {
+		if code := upload(t, srv, tc.token, png(1500)); code != tc.want {
+			t.Errorf("%s upload = %d, want %d", tc.name, code, tc.want)
+		}
+	}
+}
+
+func TestSetMediaModerator(t *testing.T) {
+	h := newTestHub(t)
+	h.SetMediaModerator(rejectMedia{})
+	srv := httptest.NewServer(h.Handler())
+	defer srv.Close()
+
+	a := dial(t, h, "cats")
+	token := recv(t, a, "session").Token
+	dial(t, h, "cats")
+	recv(t, a, "paired")
+	if code := upload(t, srv, token, png(100)); code != http.StatusUnprocessableEntity {
+		t.Errorf("upload = %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestMediaTypesMustBeRaster(t *testing.T) {
+	for types, ok := range map[string]bool{
+		"image/png,image/jpeg,image/gif,image/webp": true,
+		"image/png,image/svg+xml":                   false,
+		"text/html":                                 false,
+		"application/pdf":                           false,
+	} {
+		_, err := hub.LoadConfig([]string{"-media-types=" + types})
+		if (err == nil) != ok {
+			t.Errorf("-media-types=%s: err = %v, want ok %v", types, err, ok)
+		}
+	}
+}
+
+func TestMediaServedSafely(t *testing.T) {
+	cfg, err := hub.LoadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Validate refuses text/html, but the handler must not rely on it.
+	cfg.MediaTypes = []string{"image/png", "text/html"}
+	h, err := hub.New(cfg, hub.WithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		h.Shutdown(ctx)
+	})
+	srv := httptest.NewServer(h.Handler())
+	defer srv.Close()
+
+	a := dial(t, h, "cats")
+	token := recv(t, a, "session").Token
+	dial(t, h, "cats")
+	recv(t, a, "paired")
+
+	for _, tc := range []struct {
+		data        []byte
+		disposition string
+		csp         string
+	}{
+		{png(100), "inline", ""},
+		{[]byte("<script>alert(document.cookie)</script>"), "attachment", "default-src 'none'"},
+	} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/upload", bytes.NewReader(tc.data))
+		req.Header.Set("X-CatChat-Session", token)
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var up struct{ URL, Type string }
+		err = json.NewDecoder(resp.Body).Decode(&up)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusCreated {
+			t.Fatalf("upload = %d, %v", resp.StatusCode, err)
+		}
+
+		resp, err = srv.Client().Get(srv.URL + up.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("Content-Disposition"); got != tc.disposition {
+			t.Errorf("%s served with Content-Disposition %q, want %q", up.Type, got, tc.disposition)
+		}
+		if got := resp.Header.Get("Content-Security-Policy"); got != tc.csp {
+			t.Errorf("%s served with Content-Security-Policy %q, want %q", up.Type, got, tc.csp)
+		}
+		if got := resp.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("%s served with X-Content-Type-Options %q", up.Type, got)
+		}
+	}
+}
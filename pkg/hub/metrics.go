@@ -0,0 +1,208 @@
+package hub
+
+import (
+	"errors"
+	"net"
+	"sort"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ---------------------- Metrics ----------------------
+
+// maxTagSeries caps how many interests get their own waiting-clients series;
+// the rest are summed under "_other" so user-chosen tags can't blow up
+// cardinality.
+const maxTagSeries = 20
+
+type metrics struct {
+	connections         prometheus.Gauge
+	pairsFormed         prometheus.Counter
+	waitSeconds         prometheus.Histogram
+	messagesRelayed     prometheus.Counter
+	messagesDropped     prometheus.Counter
+	profanityHits       prometheus.Counter
+	abnormalDisconnects *prometheus.CounterVec
+	strikes             *prometheus.CounterVec
+	connectionsRejected *prometheus.CounterVec
+	floodDetections     *prometheus.CounterVec
+	floodActions        *prometheus.CounterVec
+	linksFiltered       *prometheus.CounterVec
+	challenges          *prometheus.CounterVec
+	webhooks            *prometheus.CounterVec
+	botSessions         prometheus.Counter
+	botHandoffs         prometheus.Counter
+	timeouts            *prometheus.CounterVec
+	frameBytes          *prometheus.HistogramVec
+}
+
+func newMetrics(reg prometheus.Registerer, h *Hub) *metrics {
+	m := &metrics{
+		connections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "catchat_active_connections",
+			Help: "Currently registered WebSocket connections.",
+		}),
+		pairsFormed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "catchat_pairs_formed_total",
+			Help: "Pairings formed.",
+		}),
+		waitSeconds: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "catchat_wait_seconds",
+			Help:    "Time each client spent waiting before being paired.",
+			Buckets: []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120, 300},
+		}),
+		messagesRelayed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "catchat_messages_relayed_total",
+			Help: "Chat messages relayed between partners.",
+		}),
+		messagesDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "catchat_messages_dropped_total",
+			Help: "Typing notifications and stats dropped because the recipient's send queue was backed up.",
+		}),
+		profanityHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "catchat_profanity_hits_total",
+			Help: "Blocked words masked by the profanity filter.",
+		}),
+		abnormalDisconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "catchat_abnormal_disconnects_total",
+			Help: "Connections that ended without a clean close, by reason.",
+		}, []string{"reason"}),
+		strikes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "catchat_strikes_total",
+			Help: "Strikes given to client addresses, by reason.",
+		}, []string{"reason"}),
+		connectionsRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "catchat_connections_rejected_total",
+			Help: "WebSocket connections turned away before the upgrade, by reason.",
+		}, []string{"reason"}),
+		floodDetections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "catchat_flood_detections_total",
+			Help: "Chat messages caught flooding, by pattern: repeat, lines or burst.",
+		}, []string{"pattern"}),
+		floodActions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "catchat_flood_actions_total",
+			Help: "Steps taken against flooding clients, by action: warn, mute or kick.",
+		}, []string{"action"}),
+		linksFiltered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "catchat_links_filtered_total",
+			Help: "Chat messages whose links were filtered, by link mode: strip, censor or block.",
+		}, []string{"mode"}),
+		challenges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "catchat_challenges_total",
+			Help: "Challenge outcomes for new connections: passed, failed or timeout.",
+		}, []string{"result"}),
+		webhooks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "catchat_webhooks_total",
+			Help: "Webhook deliveries per URL, by event and result: delivered, failed or dropped.",
+		}, []string{"event", "result"}),
+		botSessions: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "catchat_bot_sessions_total",
+			Help: "Waiting clients given a bot companion.",
+		}),
+		botHandoffs: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "catchat_bot_handoffs_total",
+			Help: "Bot companions handed over to a real partner.",
+		}),
+		timeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "catchat_timeouts_total",
+			Help: "Clients disconnected for reaching a limit: idle or session limit.",
+		}, []string{"limit"}),
+		frameBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "catchat_frame_bytes",
+			Help:    "Size of frames sent to clients as written to the socket, after any compression, by message type.",
+			Buckets: prometheus.ExponentialBuckets(32, 4, 8),
+		}, []string{"type"}),
+	}
+	reg.MustRegister(
+		m.connections,
+		m.pairsFormed,
+		m.waitSeconds,
+		m.messagesRelayed,
+		m.messagesDropped,
+		m.profanityHits,
+		m.abnormalDisconnects,
+		m.strikes,
+		m.connectionsRejected,
+		m.floodDetections,
+		m.floodActions,
+		m.linksFiltered,
+		m.challenges,
+		m.webhooks,
+		m.botSessions,
+		m.botHandoffs,
+		m.timeouts,
+		m.frameBytes,
+		&waitingCollector{hub: h},
+	)
+	return m
+}
+
+// readDisconnectReason classifies a readPump error, returning "" for
+// clean closes and for connections the server closed itself.
+func readDisconnectReason(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "pong_timeout"
+	case errors.Is(err, websocket.ErrReadLimit):
+		return "frame_too_large"
+	case websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway):
+		return "unexpected_close"
+	}
+	return ""
+}
+
+// noteAbnormal counts c's disconnect under reason, unless it has already
+// been counted under another.
+func (c *Client) noteAbnormal(reason string) {
+	if c.abnormal.CompareAndSwap(false, true) {
+		c.hub.metrics.abnormalDisconnects.WithLabelValues(reason).Inc()
+		c.log.Info("connection dropped", "reason", reason)
+	}
+}
+
+var waitingDesc = prometheus.NewDesc(
+	"catchat_waiting_clients",
+	"Clients waiting for a partner, by interest. A client with several interests is counted under each.",
+	[]string{"tag"}, nil,
+)
+
+// waitingCollector reads per-interest queue depths from a hub snapshot at
+// scrape time.
+type waitingCollector struct {
+	hub *Hub
+}
+
+func (wc *waitingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- waitingDesc
+}
+
+func (wc *waitingCollector) Collect(ch chan<- prometheus.Metric) {
+	type depth struct {
+		tag string
+		n   int
+	}
+	var depths []depth
+	for tag, ids := range wc.hub.Snapshot().Waiting {
+		depths = append(depths, depth{tag, len(ids)})
+	}
+	sort.Slice(depths, func(i, j int) bool {
+		if depths[i].n != depths[j].n {
+			return depths[i].n > depths[j].n
+		}
+		return depths[i].tag < depths[j].tag
+	})
+
+	other := 0
+	for i, d := range depths {
+		if i < maxTagSeries {
+			ch <- prometheus.MustNewConstMetric(waitingDesc, prometheus.GaugeValue, float64(d.n), d.tag)
+		} else {
+			other += d.n
+		}
+	}
+	if other > 0 {
+		ch <- prometheus.MustNewConstMetric(waitingDesc, prometheus.GaugeValue, float64(other), "_other")
+	}
+}
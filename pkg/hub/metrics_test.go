@@ -0,0 +1,119 @@
+package hub_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// wsRecv reads frames from c until one of type typ, returning it and the
+// size of its JSON.
+func wsRecv(t *testing.T, c *websocket.Conn, typ string) (client.Message, int) {
+	t.Helper()
+	for {
+		_, data, err := c.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", typ, err)
+		}
+		var msg client.Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == typ {
+			return msg, len(data)
+		}
+	}
+}
+
+// frameBytes returns the sum and count of the catchat_frame_bytes samples
+// for typ.
+func frameBytes(t *testing.T, reg *prometheus.Registry, typ string) (sum float64, count uint64) {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != "catchat_frame_bytes" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "type" && l.GetValue() == typ {
+					return m.GetHistogram().GetSampleSum(), m.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	return 0, 0
+}
+
+// frameUsage pairs two WebSocket clients, has one send the other a long,
+// repetitive message and returns the size that message was recorded at,
+// the size of its JSON and the receiver's usage total.
+func frameUsage(t *testing.T, compress bool) (recorded float64, encoded int, usage int64) {
+	reg := prometheus.NewRegistry()
+	// A write buffer bigger than the message keeps it to one frame.
+	h := newTestHubMetrics(t, reg, "-write-buffer=8192", "-compression="+strconv.FormatBool(compress))
+	srv := httptest.NewServer(h.Handler())
+	t.Cleanup(srv.Close)
+
+	dialer := websocket.Dialer{EnableCompression: compress}
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?tag=frames"
+	var conns [2]*websocket.Conn
+	for i := range conns {
+		c, _, err := dialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		conns[i] = c
+	}
+	a, b := conns[0], conns[1]
+	wsRecv(t, a, "paired")
+	wsRecv(t, b, "paired")
+
+	if err := a.WriteJSON(client.Message{Type: "message", Text: strings.Repeat("meow ", 300)}); err != nil {
+		t.Fatal(err)
+	}
+	_, encoded = wsRecv(t, b, "message")
+	if err := b.WriteJSON(client.Message{Type: "usage"}); err != nil {
+		t.Fatal(err)
+	}
+	msg, _ := wsRecv(t, b, "usage")
+
+	recorded, count := frameBytes(t, reg, "message")
+	if count != 1 {
+		t.Fatalf("%d message frames recorded, want 1", count)
+	}
+	return recorded, encoded, msg.Bytes
+}
+
+func TestFrameBytes(t *testing.T) {
+	plain, encoded, plainUsage := frameUsage(t, false)
+	// Uncompressed, a server frame of 126 to 65535 bytes has a 4-byte
+	// header.
+	if want := float64(encoded + 4); plain != want {
+		t.Errorf("uncompressed message frame recorded at %g bytes, want %g", plain, want)
+	}
+	if plainUsage < int64(plain) {
+		t.Errorf("uncompressed usage = %d, want at least the message's %g", plainUsage, plain)
+	}
+
+	deflated, deflatedEncoded, deflatedUsage := frameUsage(t, true)
+	if deflatedEncoded != encoded {
+		t.Errorf("compressed message decodes to %d bytes, want %d", deflatedEncoded, encoded)
+	}
+	if deflated >= plain/4 {
+		t.Errorf("compressed message frame recorded at %g bytes, want under a quarter of %g", deflated, plain)
+	}
+	if deflatedUsage >= plainUsage {
+		t.Errorf("compressed usage = %d, want under uncompressed %d", deflatedUsage, plainUsage)
+	}
+}
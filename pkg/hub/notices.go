@@ -0,0 +1,35 @@
+package hub
+
+import (
+	"strings"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Notices ----------------------
+
+// Every server message that tells the user something carries a code
+// naming exactly what happened (see package client for them), and the
+// values it mentions in Data, so clients can branch on it or word it
+// themselves. Text is its rendering in the client's language (see
+// i18n.go) for clients that just display it. Templates live in
+// locales/<lang>.json, where {name} stands for Data["name"].
+
+// notice builds a server message of the given type for code, rendered in
+// English until deliver localizes it for its recipient.
+func (h *Hub) notice(msgType, code string, data map[string]string) client.Message {
+	msg := h.serverMessage(msgType, renderNotice(h.catalog.Text(defaultLang, code), data))
+	msg.Code, msg.Data = code, data
+	return msg
+}
+
+func renderNotice(text string, data map[string]string) string {
+	if len(data) == 0 {
+		return text
+	}
+	pairs := make([]string, 0, 2*len(data))
+	for k, v := range data {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
@@ -0,0 +1,232 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+	"github.com/gorilla/websocket"
+)
+
+// ---------------------- Moderator Observation ----------------------
+
+// A moderator can open a WebSocket to /admin/observe?id=<session ID>,
+// naming either member of a pair (a report's reporterId or reportedId, or
+// one from /admin/pairs), to watch that pair's chat as it happens. The
+// stream starts with an observing message listing both members as a and b
+// in Data, followed by the buffered transcript and then every message and
+// media message either side sends, with From set to the sender's session
+// ID. Neither member is told. The moderator can send
+//
+//	{"type": "end"}
+//	{"type": "ban", "id": "<member>", "reason": "...", "duration": "24h"}
+//
+// to end the pair or to ban a member's address, which disconnects them;
+// an empty duration bans for good. The stream ends with pair_ended once
+// the pair is over.
+
+// observer is a moderator's stream. Everything but conn is owned by the
+// run loop.
+type observer struct {
+	conn *websocket.Conn
+	send chan client.Message
+	// a and b are the members being watched; pairing is cleared when the
+	// pair ends.
+	a, b    string
+	pairing *pairing
+	closed  bool
+}
+
+func (o *observer) close() {
+	if !o.closed {
+		o.closed = true
+		close(o.send)
+	}
+}
+
+// forward queues msg for o, returning false if o has fallen too far
+// behind.
+func (o *observer) forward(msg client.Message) bool {
+	if o.closed {
+		return false
+	}
+	select {
+	case o.send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// observe attaches o to the pair the client id is in. It runs on the run
+// loop.
+func (h *Hub) observe(o *observer, id string) error {
+	c := h.clientByID(id)
+	if c == nil {
+		return ErrClientNotFound
+	}
+	p := c.pairing
+	if p == nil || c.room != nil {
+		return ErrNotPaired
+	}
+	o.a, o.b, o.pairing = p.a.id, p.b.id, p
+	p.observers = append(p.observers, o)
+
+	msg := h.serverMessage("observing", "")
+	msg.Data = map[string]string{"a": o.a, "b": o.b}
+	o.forward(msg)
+	for _, line := range p.transcript.snapshot() {
+		msg := client.Message{Type: "message", From: line.From, Text: line.Text}
+		h.stamp(&msg, line.At)
+		o.forward(msg)
+	}
+	return nil
+}
+
+// unobserve detaches o from its pair. It runs on the run loop.
+func (h *Hub) unobserve(o *observer) {
+	if p := o.pairing; p != nil {
+		for i, other := range p.observers {
+			if other == o {
+				p.observers = append(p.observers[:i], p.observers[i+1:]...)
+				break
+			}
+		}
+		o.pairing = nil
+	}
+	o.close()
+}
+
+// notifyObservers copies msg, sent by from, to everyone watching from's
+// pair.
+func (h *Hub) notifyObservers(from *Client, msg client.Message) {
+	p := from.pairing
+	if p == nil || len(p.observers) == 0 {
+		return
+	}
+	msg.From = from.id
+	for _, o := range append([]*observer(nil), p.observers...) {
+		if !o.forward(msg) {
+			slog.Warn("dropping observer that fell behind", "session", o.a, "partner", o.b)
+			h.unobserve(o)
+		}
+	}
+}
+
+// endObservation tells p's observers the pair is over and closes their
+// streams.
+func (p *pairing) endObservation() {
+	for _, o := range p.observers {
+		o.forward(client.Message{Type: "pair_ended", From: client.FromServer})
+		o.pairing = nil
+		o.close()
+	}
+	p.observers = nil
+}
+
+// handleObserve serves the /admin/observe WebSocket.
+func (h *Hub) handleObserve(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	o := &observer{send: make(chan client.Message, h.limits.ObserverBuffer)}
+	var err error
+	h.do(func() { err = h.observe(o, id) })
+	switch {
+	case errors.Is(err, ErrClientNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, ErrNotPaired):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.do(func() { h.unobserve(o) })
+		slog.Error("observer upgrade", "err", err)
+		return
+	}
+	o.conn = conn
+	slog.Info("moderator observing pair", "session", o.a, "partner", o.b)
+	go h.observerWrites(o)
+	h.observerReads(o)
+}
+
+func (h *Hub) observerWrites(o *observer) {
+	defer o.conn.Close()
+	for msg := range o.send {
+		o.conn.SetWriteDeadline(time.Now().Add(h.limits.WriteWait))
+		if err := o.conn.WriteJSON(msg); err != nil {
+			h.do(func() { h.unobserve(o) })
+			for range o.send {
+			}
+			return
+		}
+	}
+	o.conn.SetWriteDeadline(time.Now().Add(h.limits.WriteWait))
+	o.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "pair ended"))
+}
+
+type observerCommand struct {
+	Type     string `json:"type"`
+	ID       string `json:"id"`
+	Reason   string `json:"reason"`
+	Duration string `json:"duration"`
+}
+
+// observerReads carries out the moderator's commands until the stream
+// closes.
+func (h *Hub) observerReads(o *observer) {
+	defer h.do(func() { h.unobserve(o) })
+	for {
+		var cmd observerCommand
+		if err := o.conn.ReadJSON(&cmd); err != nil {
+			return
+		}
+		var err error
+		switch cmd.Type {
+		case "end":
+			if err = h.BreakPair(o.a); errors.Is(err, ErrClientNotFound) {
+				err = h.BreakPair(o.b)
+			}
+		case "ban":
+			err = h.banMember(o, cmd)
+		default:
+			err = errors.New("unknown command")
+		}
+		reply := client.Message{Type: "done", From: client.FromServer, Text: cmd.Type}
+		if err != nil {
+			reply = client.Message{Type: "error", From: client.FromServer, Text: err.Error()}
+		}
+		h.do(func() { o.forward(reply) })
+	}
+}
+
+// banMember bans the address of the watched member cmd names.
+func (h *Hub) banMember(o *observer, cmd observerCommand) error {
+	if cmd.ID != o.a && cmd.ID != o.b {
+		return errors.New("id must be a member of the observed pair")
+	}
+	var d time.Duration
+	if cmd.Duration != "" {
+		var err error
+		if d, err = time.ParseDuration(cmd.Duration); err != nil || d <= 0 {
+			return errors.New("duration must be a positive Go duration")
+		}
+	}
+	var ip netip.Addr
+	h.do(func() {
+		if c := h.clientByID(cmd.ID); c != nil {
+			ip = c.ip
+		}
+	})
+	if !ip.IsValid() {
+		return ErrClientNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.limits.StoreTimeout)
+	defer cancel()
+	_, err := h.addBan(ctx, netip.PrefixFrom(ip, ip.BitLen()), cmd.Reason, d)
+	return err
+}
@@ -0,0 +1,32 @@
+package hub
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// ---------------------- Options ----------------------
+
+// Option customises a hub made by New.
+type Option func(*options)
+
+type options struct {
+	reg     prometheus.Registerer
+	reports ReportStore
+	bans    BanStore
+}
+
+// WithRegisterer registers the hub's metrics with reg instead of
+// prometheus.DefaultRegisterer.
+func WithRegisterer(reg prometheus.Registerer) Option {
+	return func(o *options) { o.reg = reg }
+}
+
+// WithReportStore keeps reports in s rather than the store the config
+// names. The hub does not close it.
+func WithReportStore(s ReportStore) Option {
+	return func(o *options) { o.reports = s }
+}
+
+// WithBanStore keeps bans in s rather than the store the config names.
+// The hub does not close it.
+func WithBanStore(s BanStore) Option {
+	return func(o *options) { o.bans = s }
+}
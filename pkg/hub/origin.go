@@ -0,0 +1,89 @@
+package hub
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ---------------------- Origin Checks ----------------------
+
+// Browsers send an Origin header on every WebSocket handshake, and the
+// upgrader only accepts the ones allowed here, so other sites can't open
+// chats with a visitor's cookies. Allowed origins are written as
+// scheme://host[:port]; a host of *.example.com admits any subdomain of
+// example.com but not example.com itself, and a lone * admits everything.
+// With no list, production mode admits only the page's own origin and
+// development mode admits any.
+
+type originPattern struct {
+	scheme string
+	// host includes the port, if any. For wildcards it keeps the leading
+	// dot, as in ".example.com".
+	host     string
+	wildcard bool
+}
+
+func parseOriginPattern(s string) (originPattern, error) {
+	u, err := url.Parse(strings.ToLower(s))
+	if err != nil {
+		return originPattern{}, err
+	}
+	if u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return originPattern{}, fmt.Errorf("origin %q must look like scheme://host[:port]", s)
+	}
+	p := originPattern{scheme: u.Scheme, host: u.Host}
+	if rest, ok := strings.CutPrefix(u.Host, "*."); ok {
+		p.host, p.wildcard = "."+rest, true
+	}
+	return p, nil
+}
+
+func (p originPattern) match(u *url.URL) bool {
+	if u.Scheme != p.scheme {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+	if p.wildcard {
+		return len(host) > len(p.host) && strings.HasSuffix(host, p.host)
+	}
+	return host == p.host
+}
+
+// originChecker builds the upgrader's CheckOrigin from cfg, which must
+// already be valid. Handshakes without an Origin header come from
+// non-browser clients and are let through.
+func originChecker(cfg Config) func(r *http.Request) bool {
+	anyOrigin := len(cfg.AllowedOrigins) == 0 && cfg.Mode == "development"
+	var patterns []originPattern
+	for _, o := range cfg.AllowedOrigins {
+		if o == "*" {
+			anyOrigin = true
+			continue
+		}
+		p, _ := parseOriginPattern(o)
+		patterns = append(patterns, p)
+	}
+	sameOrigin := len(cfg.AllowedOrigins) == 0
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || anyOrigin {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err == nil {
+			if sameOrigin && strings.EqualFold(u.Host, r.Host) {
+				return true
+			}
+			for _, p := range patterns {
+				if p.match(u) {
+					return true
+				}
+			}
+		}
+		slog.Warn("rejected WebSocket origin", "origin", origin, "remote", r.RemoteAddr)
+		return false
+	}
+}
@@ -0,0 +1,124 @@
+package hub
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Rate Limiting ----------------------
+
+// tokenBucket allows bursts of up to burst events, refilled at rate per
+// second. It belongs to a single readPump and is not safe for concurrent
+// use.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// allow takes a token if one is available.
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// wait is how long until allow would next succeed.
+func (b *tokenBucket) wait(now time.Time) time.Duration {
+	tokens := math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / b.rate * float64(time.Second))
+}
+
+// rateLimiter throttles a client's chat and typing frames and decides when
+// a client has been throttled often enough to be disconnected. It also
+// spaces out the client's requeues, so cycling through partners can't
+// hammer matching.
+type rateLimiter struct {
+	message *tokenBucket
+	typing  *tokenBucket
+
+	requeue     *tokenBucket
+	cooldown    time.Duration
+	lastRequeue time.Time
+
+	maxViolations int
+	window        time.Duration
+	windowStart   time.Time
+	violations    int
+}
+
+func newRateLimiter(l Limits) *rateLimiter {
+	return &rateLimiter{
+		message:       newTokenBucket(l.MessageRate, l.MessageBurst),
+		typing:        newTokenBucket(l.TypingRate, l.TypingBurst),
+		requeue:       newTokenBucket(l.RequeueRate, l.RequeueBurst),
+		cooldown:      l.NextCooldown,
+		maxViolations: l.MaxRateViolations,
+		window:        l.RateViolationWindow,
+	}
+}
+
+// violate records a rejected frame and reports whether the client has now
+// exceeded its allowance of rejections for the current window.
+func (r *rateLimiter) violate(now time.Time) bool {
+	if now.Sub(r.windowStart) > r.window {
+		r.windowStart, r.violations = now, 0
+	}
+	r.violations++
+	return r.violations > r.maxViolations
+}
+
+// requeueWait takes a requeue if the client may have one now, returning 0,
+// or otherwise returns how long it has to wait for the next.
+func (r *rateLimiter) requeueWait(now time.Time) time.Duration {
+	if wait := r.lastRequeue.Add(r.cooldown).Sub(now); wait > 0 {
+		return wait
+	}
+	if wait := r.requeue.wait(now); wait > 0 {
+		return wait
+	}
+	r.requeue.allow(now)
+	r.lastRequeue = now
+	return 0
+}
+
+// coolingDown tells c how long to wait if it may not requeue yet.
+func (c *Client) coolingDown(r *rateLimiter, now time.Time) bool {
+	wait := r.requeueWait(now)
+	if wait <= 0 {
+		return false
+	}
+	seconds := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+	c.reply(c.hub.notice("cooldown", client.CodeCooldown, map[string]string{"seconds": seconds}))
+	return true
+}
+
+// bucket returns the bucket that throttles frames of msgType, or nil if
+// they are not rate limited.
+func (r *rateLimiter) bucket(msgType string) *tokenBucket {
+	switch msgType {
+	case "message", "media":
+		return r.message
+	case "typing", "typing_start", "typing_stop":
+		return r.typing
+	}
+	return nil
+}
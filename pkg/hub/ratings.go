@@ -0,0 +1,146 @@
+package hub
+
+import (
+	"net/http"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Ratings ----------------------
+
+// Once a chat ends, either side may rate it once with a rate_partner
+// message. Ratings are held against the partner's address, which is all
+// that identifies someone across connections, for limits.RatingWindow and
+// only in memory. An address that has collected at least
+// limits.LowRatingCount ratings averaging limits.LowRatingScore or less
+// waits limits.LowRatingPenalty longer than everyone else to be matched.
+// Partners on other instances have no address here and can't be rated.
+
+// RatingSummary aggregates the ratings an address has received within
+// the window.
+type RatingSummary struct {
+	IP      string         `json:"ip"`
+	Count   int            `json:"count"`
+	Average float64        `json:"average"`
+	Flags   map[string]int `json:"flags,omitempty"`
+	Low     bool           `json:"low"`
+}
+
+type givenRating struct {
+	client.Rating
+	at time.Time
+}
+
+type ratingTracker struct {
+	limits Limits
+
+	mu      sync.Mutex
+	ratings map[netip.Addr][]givenRating
+}
+
+func newRatingTracker(limits Limits) *ratingTracker {
+	return &ratingTracker{limits: limits, ratings: make(map[netip.Addr][]givenRating)}
+}
+
+func (t *ratingTracker) add(ip netip.Addr, r client.Rating, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ratings[ip] = append(t.recent(ip, now), givenRating{Rating: r, at: now})
+}
+
+// recent prunes and returns ip's ratings within the window. t.mu must be
+// held.
+func (t *ratingTracker) recent(ip netip.Addr, now time.Time) []givenRating {
+	kept := t.ratings[ip][:0]
+	for _, g := range t.ratings[ip] {
+		if now.Sub(g.at) < t.limits.RatingWindow {
+			kept = append(kept, g)
+		}
+	}
+	if len(kept) == 0 {
+		delete(t.ratings, ip)
+		return nil
+	}
+	t.ratings[ip] = kept
+	return kept
+}
+
+// summary aggregates ip's ratings. t.mu must be held.
+func (t *ratingTracker) summary(ip netip.Addr, now time.Time) RatingSummary {
+	s := RatingSummary{IP: ip.String()}
+	total := 0
+	for _, g := range t.recent(ip, now) {
+		s.Count++
+		total += g.Score
+		for _, f := range g.Flags {
+			if s.Flags == nil {
+				s.Flags = make(map[string]int)
+			}
+			s.Flags[f]++
+		}
+	}
+	if s.Count > 0 {
+		s.Average = float64(total) / float64(s.Count)
+	}
+	s.Low = s.Count >= t.limits.LowRatingCount && s.Average <= t.limits.LowRatingScore
+	return s
+}
+
+// low reports whether ip is rated low enough to be matched last.
+func (t *ratingTracker) low(ip netip.Addr) bool {
+	if !ip.IsValid() {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.summary(ip, time.Now()).Low
+}
+
+// List summarises every rated address, lowest average first.
+func (t *ratingTracker) List() []RatingSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	out := []RatingSummary{}
+	for ip := range t.ratings {
+		if s := t.summary(ip, now); s.Count > 0 {
+			out = append(out, s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Average != out[j].Average {
+			return out[i].Average < out[j].Average
+		}
+		return out[i].Count > out[j].Count
+	})
+	return out
+}
+
+// ratePartner records c's rating of its last partner. It runs on the run
+// loop.
+func (h *Hub) ratePartner(c *Client, r client.Rating) {
+	if !h.clients[c] {
+		return
+	}
+	ip := c.lastPartnerIP
+	if !ip.IsValid() {
+		h.deliver(c, h.notice("system", client.CodeNoRatingPartner, nil))
+		return
+	}
+	c.lastPartnerIP = netip.Addr{}
+	r.Flags = r.KnownFlags()
+	h.ratings.add(ip, r, time.Now())
+	h.deliver(c, h.notice("system", client.CodeRatingSaved, nil))
+}
+
+// handleRatings serves GET /admin/ratings.
+func (h *Hub) handleRatings(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, h.ratings.List())
+}
@@ -0,0 +1,240 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------------------- Redis Backend ----------------------
+
+// Keys used in Redis. The waiting pool is a sorted set of session IDs
+// scored by the time they started waiting, with each entry's details in a
+// hash next to it. Every instance subscribes to its own channel for peer
+// events.
+const (
+	redisWaitingKey     = "catchat:waiting"
+	redisEntryPrefix    = "catchat:entry:"
+	redisInstancePrefix = "catchat:instance:"
+)
+
+// matchScript is HubBackend.Match run atomically inside Redis, so two
+// instances can never take the same waiting client. It reads the entry
+// hashes by name, so it only works against a single Redis server, not a
+// cluster.
+//
+// KEYS[1] is the waiting set; ARGV is the entry prefix, then the
+// requester's ID, instance, comma-separated interests, start time in
+// milliseconds, comma-separated avoided IDs and the general pool cutoff
+// in milliseconds. It returns the matched ID, instance, interests, start
+// time and shared interests, or nil after queueing the requester.
+var matchScript = redis.NewScript(redisAvoidsLua + `
+local prefix, id = ARGV[1], ARGV[2]
+local mine = {}
+for tag in string.gmatch(ARGV[4], '[^,]+') do table.insert(mine, tag) end
+
+local best, bestShared, general = nil, {}, nil
+local waiting = redis.call('ZRANGE', KEYS[1], 0, -1, 'WITHSCORES')
+for i = 1, #waiting, 2 do
+  local other = waiting[i]
+  if other ~= id and not avoids(prefix, id, ARGV[6], other) then
+    local theirs = {}
+    for tag in string.gmatch(redis.call('HGET', prefix .. other, 'interests') or '', '[^,]+') do
+      theirs[tag] = true
+    end
+    local shared = {}
+    for _, tag in ipairs(mine) do
+      if theirs[tag] then table.insert(shared, tag) end
+    end
+    if #shared > #bestShared then best, bestShared = other, shared end
+    if not general and tonumber(waiting[i + 1]) <= tonumber(ARGV[7]) then general = other end
+  end
+end
+best = best or general
+
+if best then
+  local e = redis.call('HMGET', prefix .. best, 'instance', 'interests', 'since')
+  redis.call('ZREM', KEYS[1], best, id)
+  redis.call('DEL', prefix .. best, prefix .. id)
+  return {best, e[1], e[2], e[3], table.concat(bestShared, ',')}
+end
+if not redis.call('ZSCORE', KEYS[1], id) then
+  redis.call('ZADD', KEYS[1], ARGV[5], id)
+  redis.call('HSET', prefix .. id, 'instance', ARGV[3], 'interests', ARGV[4], 'since', ARGV[5], 'avoid', ARGV[6])
+end
+return false
+`)
+
+// matchAnyScript is HubBackend.MatchAny. Its KEYS and ARGV are those of
+// matchScript, with the cutoff being minWait's.
+var matchAnyScript = redis.NewScript(redisAvoidsLua + `
+local prefix, id = ARGV[1], ARGV[2]
+if not redis.call('ZSCORE', KEYS[1], id) then
+  redis.call('ZADD', KEYS[1], ARGV[5], id)
+  redis.call('HSET', prefix .. id, 'instance', ARGV[3], 'interests', ARGV[4], 'since', ARGV[5], 'avoid', ARGV[6])
+  return false
+end
+local pick = nil
+for _, other in ipairs(redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[7])) do
+  if other ~= id then
+    if not avoids(prefix, id, ARGV[6], other) then
+      pick = other
+      break
+    end
+    pick = pick or other
+  end
+end
+if not pick then return false end
+local e = redis.call('HMGET', prefix .. pick, 'instance', 'interests', 'since')
+redis.call('ZREM', KEYS[1], pick, id)
+redis.call('DEL', prefix .. pick, prefix .. id)
+return {pick, e[1], e[2], e[3], ''}
+`)
+
+// redisAvoidsLua defines avoids(prefix, id, avoid, other) for the match
+// scripts: whether id's comma-separated avoid list names other, or
+// other's stored list names id.
+const redisAvoidsLua = `
+local function listed(list, id)
+  for x in string.gmatch(list or '', '[^,]+') do
+    if x == id then return true end
+  end
+  return false
+end
+local function avoids(prefix, id, avoid, other)
+  return listed(avoid, other) or listed(redis.call('HGET', prefix .. other, 'avoid'), id)
+end
+`
+
+type redisBackend struct {
+	rdb      *redis.Client
+	sub      *redis.PubSub
+	instance string
+	events   chan peerEvent
+}
+
+// openRedisBackend connects to Redis at addr and subscribes to this
+// instance's event channel under a fresh random instance ID.
+func openRedisBackend(addr string) (*redisBackend, error) {
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		return nil, err
+	}
+
+	b := &redisBackend{
+		rdb:      rdb,
+		instance: newSessionID(),
+		events:   make(chan peerEvent),
+	}
+	b.sub = rdb.Subscribe(ctx, redisInstancePrefix+b.instance)
+	if _, err := b.sub.Receive(ctx); err != nil {
+		b.sub.Close()
+		rdb.Close()
+		return nil, err
+	}
+	go b.receive()
+	return b, nil
+}
+
+func (b *redisBackend) receive() {
+	defer close(b.events)
+	for m := range b.sub.Channel() {
+		var ev peerEvent
+		if err := json.Unmarshal([]byte(m.Payload), &ev); err != nil {
+			slog.Error("decoding peer event", "err", err)
+			continue
+		}
+		b.events <- ev
+	}
+}
+
+func (b *redisBackend) Instance() string { return b.instance }
+
+func (b *redisBackend) Match(ctx context.Context, e waitEntry, generalAfter time.Duration) (waitEntry, []string, bool, error) {
+	cutoff := time.Now().Add(-generalAfter).UnixMilli()
+	args := append(b.entryArgs(e), cutoff)
+	res, err := matchScript.Run(ctx, b.rdb, []string{redisWaitingKey}, args...).StringSlice()
+	if errors.Is(err, redis.Nil) {
+		return waitEntry{}, nil, false, nil
+	}
+	if err != nil {
+		return waitEntry{}, nil, false, err
+	}
+	w, err := parseRedisEntry(res)
+	return w, splitTags(res[4]), err == nil, err
+}
+
+func (b *redisBackend) MatchAny(ctx context.Context, e waitEntry, minWait time.Duration) (waitEntry, bool, error) {
+	cutoff := time.Now().Add(-minWait).UnixMilli()
+	args := append(b.entryArgs(e), cutoff)
+	res, err := matchAnyScript.Run(ctx, b.rdb, []string{redisWaitingKey}, args...).StringSlice()
+	if errors.Is(err, redis.Nil) {
+		return waitEntry{}, false, nil
+	}
+	if err != nil {
+		return waitEntry{}, false, err
+	}
+	w, err := parseRedisEntry(res)
+	return w, err == nil, err
+}
+
+func (b *redisBackend) Remove(ctx context.Context, id string) error {
+	_, err := b.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZRem(ctx, redisWaitingKey, id)
+		p.Del(ctx, redisEntryPrefix+id)
+		return nil
+	})
+	return err
+}
+
+func (b *redisBackend) Publish(ctx context.Context, instance string, ev peerEvent) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return b.rdb.Publish(ctx, redisInstancePrefix+instance, payload).Err()
+}
+
+func (b *redisBackend) Events() <-chan peerEvent { return b.events }
+
+func (b *redisBackend) Close() error {
+	return errors.Join(b.sub.Close(), b.rdb.Close())
+}
+
+func (b *redisBackend) entryArgs(e waitEntry) []interface{} {
+	return []interface{}{redisEntryPrefix, e.ID, e.Instance, strings.Join(e.Interests, ","), e.Since.UnixMilli(), strings.Join(e.Avoid, ",")}
+}
+
+// parseRedisEntry decodes the ID, instance, interests and start time a
+// match script returns.
+func parseRedisEntry(res []string) (waitEntry, error) {
+	if len(res) != 5 {
+		return waitEntry{}, errors.New("unexpected match script reply")
+	}
+	ms, err := strconv.ParseInt(res[3], 10, 64)
+	if err != nil {
+		return waitEntry{}, err
+	}
+	return waitEntry{
+		ID:        res[0],
+		Instance:  res[1],
+		Interests: splitTags(res[2]),
+		Since:     time.UnixMilli(ms),
+	}, nil
+}
+
+func splitTags(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
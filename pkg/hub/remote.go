@@ -0,0 +1,130 @@
+package hub
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Cross-Instance Pairings ----------------------
+
+// A partner hosted on another instance is represented on this one by a
+// proxy Client: it has no connection, its remote field names its instance,
+// and a forwardPump publishes whatever the hub delivers to it. Proxies live
+// in h.proxies, keyed by session ID, and never in h.clients.
+
+// newProxy creates the local stand-in for a client on another instance.
+func (h *Hub) newProxy(id, instance string, interests []string, partnerID string) *Client {
+	connID := newConnID()
+	p := &Client{
+		id:        id,
+		connID:    connID,
+		log:       slog.With("conn", connID, "instance", instance),
+		remote:    instance,
+		partnerID: partnerID,
+		hub:       h,
+		interests: interests,
+		createdAt: time.Now(),
+		send:      make(chan client.Message, h.limits.SendBuffer),
+	}
+	h.proxies[id] = p
+	go p.forwardPump()
+	return p
+}
+
+// removeProxy ends a proxy's pairing from this side, on both instances.
+func (h *Hub) removeProxy(p *Client) {
+	if h.proxies[p.id] != p {
+		return
+	}
+	h.publish(p.remote, peerEvent{Kind: "unpair", From: p.partnerID, To: p.id, Reason: client.CodePartnerLeft})
+	h.unpair(p, client.CodePartnerLeft)
+	h.dropProxy(p)
+}
+
+// dropProxy forgets p and stops its forwardPump.
+func (h *Hub) dropProxy(p *Client) {
+	if h.proxies[p.id] != p {
+		return
+	}
+	delete(h.proxies, p.id)
+	p.closeSend()
+}
+
+// forwardPump publishes the partner messages relayed to a proxy to the
+// instance its client lives on. Server messages stay local: each instance
+// sends its own to its own clients.
+func (c *Client) forwardPump() {
+	for msg := range c.send {
+		if msg.From != client.FromPartner {
+			continue
+		}
+		ev := peerEvent{Kind: "relay", From: c.partnerID, To: c.id, Instance: c.hub.backend.Instance(), Message: &msg}
+		ctx, cancel := context.WithTimeout(context.Background(), c.hub.limits.BackendTimeout)
+		if err := c.hub.backend.Publish(ctx, c.remote, ev); err != nil {
+			slog.Error("forwarding message", "err", err)
+		}
+		cancel()
+	}
+}
+
+// publish sends ev to instance from the run loop, logging failures.
+func (h *Hub) publish(instance string, ev peerEvent) {
+	ev.Instance = h.backend.Instance()
+	ctx, cancel := context.WithTimeout(context.Background(), h.limits.BackendTimeout)
+	defer cancel()
+	if err := h.backend.Publish(ctx, instance, ev); err != nil {
+		slog.Error("publishing peer event", "err", err)
+	}
+}
+
+// resolve returns the client behind a pool entry: the local client itself,
+// or a new proxy for one on another instance, which is told it has been
+// paired with c. It returns nil if a local entry's client has already gone.
+func (h *Hub) resolve(c *Client, w waitEntry, shared []string) *Client {
+	if w.Instance == h.backend.Instance() {
+		return h.clientByID(w.ID)
+	}
+	h.publish(w.Instance, peerEvent{Kind: "pair", From: c.id, To: w.ID, Interests: c.interests, Shared: shared})
+	return h.newProxy(w.ID, w.Instance, w.Interests, c.id)
+}
+
+func (h *Hub) handlePeerEvent(ev peerEvent) {
+	switch ev.Kind {
+	case "pair":
+		// Another instance took our client out of the pool. If it has left
+		// or been paired here in the meantime, tell the other side to
+		// requeue its client.
+		c := h.clientByID(ev.To)
+		if c == nil || !h.isWaiting(c) {
+			h.publish(ev.Instance, peerEvent{Kind: "unpair", From: ev.To, To: ev.From, Reason: client.CodePartnerLeft})
+			return
+		}
+		// The fallback timer may have put c back in the pool since it was
+		// taken.
+		ctx, cancel := context.WithTimeout(context.Background(), h.limits.BackendTimeout)
+		if err := h.backend.Remove(ctx, c.id); err != nil {
+			c.log.Error("leaving waiting pool", "err", err)
+		}
+		cancel()
+		h.pair(c, h.newProxy(ev.From, ev.Instance, ev.Interests, c.id), ev.Shared)
+
+	case "relay":
+		if p := h.proxies[ev.From]; p != nil && p.partnerID == ev.To && ev.Message != nil {
+			h.relayMessage(p, *ev.Message)
+		}
+
+	case "unpair":
+		if p := h.proxies[ev.From]; p != nil && p.partnerID == ev.To {
+			h.unpair(p, ev.Reason)
+			h.dropProxy(p)
+		}
+
+	case "presence":
+		if p := h.proxies[ev.From]; p != nil && p.partnerID == ev.To && p.partner != nil && ev.Message != nil {
+			h.deliver(p.partner, h.notice(ev.Message.Type, ev.Message.Code, ev.Message.Data))
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package hub
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ---------------------- Reports ----------------------
+
+// Report is a user's complaint about their partner, with the recent
+// conversation attached for moderators.
+type Report struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ReporterID string    `json:"reporterId"`
+	ReportedID string    `json:"reportedId"`
+	// ReportedIP is the reported client's address, if it was connected to
+	// this instance.
+	ReportedIP string           `json:"reportedIp,omitempty"`
+	Reason     string           `json:"reason"`
+	Transcript []TranscriptLine `json:"transcript"`
+	// Confirmed is set once a moderator has upheld the report.
+	Confirmed bool `json:"confirmed"`
+}
+
+// TranscriptLine is one relayed message; From is the sender's session ID.
+type TranscriptLine struct {
+	From string    `json:"from"`
+	Text string    `json:"text"`
+	At   time.Time `json:"at"`
+}
+
+var (
+	ErrReportNotFound  = errors.New("report not found")
+	ErrReportConfirmed = errors.New("report already confirmed")
+)
+
+// ReportStore persists reports for moderator review.
+type ReportStore interface {
+	Save(ctx context.Context, r *Report) error
+	Get(ctx context.Context, id int64) (Report, error)
+	// List returns the newest reports first.
+	List(ctx context.Context, limit int) ([]Report, error)
+	// Confirm marks a report as upheld and returns it.
+	Confirm(ctx context.Context, id int64) (Report, error)
+	Close() error
+}
+
+// transcript is a fixed-size ring of the most recent lines of a pairing.
+// Like the pairing that owns it, it is only used on the hub's run loop. It
+// lives in memory only: a snapshot is stored when a report is filed, and
+// the lines are wiped as soon as the pairing ends.
+type transcript struct {
+	lines []TranscriptLine
+	next  int
+	full  bool
+}
+
+func newTranscript(size int) *transcript {
+	return &transcript{lines: make([]TranscriptLine, size)}
+}
+
+func (t *transcript) add(line TranscriptLine) {
+	t.lines[t.next] = line
+	t.next = (t.next + 1) % len(t.lines)
+	if t.next == 0 {
+		t.full = true
+	}
+}
+
+// purge forgets every buffered line.
+func (t *transcript) purge() {
+	clear(t.lines)
+	t.next, t.full = 0, false
+}
+
+// snapshot returns the buffered lines, oldest first.
+func (t *transcript) snapshot() []TranscriptLine {
+	if !t.full {
+		return append([]TranscriptLine(nil), t.lines[:t.next]...)
+	}
+	out := make([]TranscriptLine, 0, len(t.lines))
+	out = append(out, t.lines[t.next:]...)
+	return append(out, t.lines[:t.next]...)
+}
+
+// ---------------------- In-Memory Report Store ----------------------
+
+type memoryReportStore struct {
+	mu      sync.Mutex
+	reports []Report
+}
+
+func newMemoryReportStore() *memoryReportStore {
+	return &memoryReportStore{}
+}
+
+func (s *memoryReportStore) Save(_ context.Context, r *Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.ID = int64(len(s.reports) + 1)
+	s.reports = append(s.reports, *r)
+	return nil
+}
+
+func (s *memoryReportStore) Get(_ context.Context, id int64) (Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > int64(len(s.reports)) {
+		return Report{}, ErrReportNotFound
+	}
+	return s.reports[id-1], nil
+}
+
+func (s *memoryReportStore) List(_ context.Context, limit int) ([]Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Report
+	for i := len(s.reports) - 1; i >= 0 && len(out) < limit; i-- {
+		out = append(out, s.reports[i])
+	}
+	return out, nil
+}
+
+func (s *memoryReportStore) Confirm(_ context.Context, id int64) (Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > int64(len(s.reports)) {
+		return Report{}, ErrReportNotFound
+	}
+	r := &s.reports[id-1]
+	if r.Confirmed {
+		return Report{}, ErrReportConfirmed
+	}
+	r.Confirmed = true
+	return *r, nil
+}
+
+func (s *memoryReportStore) Close() error { return nil }
+
+// ---------------------- SQLite Report Store ----------------------
+
+type sqliteReportStore struct {
+	db *sql.DB
+}
+
+func openSQLiteReportStore(path string) (*sqliteReportStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS reports (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at  TIMESTAMP NOT NULL,
+		reporter_id TEXT NOT NULL,
+		reported_id TEXT NOT NULL,
+		reason      TEXT NOT NULL,
+		transcript  TEXT NOT NULL
+	)`)
+	if err == nil {
+		err = addColumn(db, "reports", "reported_ip TEXT NOT NULL DEFAULT ''")
+	}
+	if err == nil {
+		err = addColumn(db, "reports", "confirmed BOOLEAN NOT NULL DEFAULT 0")
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteReportStore{db: db}, nil
+}
+
+func (s *sqliteReportStore) Save(ctx context.Context, r *Report) error {
+	lines, err := json.Marshal(r.Transcript)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO reports (created_at, reporter_id, reported_id, reported_ip, reason, transcript) VALUES (?, ?, ?, ?, ?, ?)`,
+		r.CreatedAt.UTC(), r.ReporterID, r.ReportedID, r.ReportedIP, r.Reason, string(lines))
+	if err != nil {
+		return err
+	}
+	r.ID, err = res.LastInsertId()
+	return err
+}
+
+func (s *sqliteReportStore) Get(ctx context.Context, id int64) (Report, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+reportColumns+` FROM reports WHERE id = ?`, id)
+	r, err := scanReport(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Report{}, ErrReportNotFound
+	}
+	return r, err
+}
+
+func (s *sqliteReportStore) List(ctx context.Context, limit int) ([]Report, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+reportColumns+` FROM reports ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Report
+	for rows.Next() {
+		r, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteReportStore) Confirm(ctx context.Context, id int64) (Report, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE reports SET confirmed = 1 WHERE id = ? AND NOT confirmed`, id)
+	if err != nil {
+		return Report{}, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return Report{}, err
+	}
+	r, err := s.Get(ctx, id)
+	if err == nil && n == 0 {
+		err = ErrReportConfirmed
+	}
+	return r, err
+}
+
+func (s *sqliteReportStore) Close() error {
+	return s.db.Close()
+}
+
+const reportColumns = `id, created_at, reporter_id, reported_id, reported_ip, reason, transcript, confirmed`
+
+func scanReport(row interface{ Scan(...any) error }) (Report, error) {
+	var r Report
+	var lines string
+	if err := row.Scan(&r.ID, &r.CreatedAt, &r.ReporterID, &r.ReportedID, &r.ReportedIP, &r.Reason, &lines, &r.Confirmed); err != nil {
+		return Report{}, err
+	}
+	if err := json.Unmarshal([]byte(lines), &r.Transcript); err != nil {
+		return Report{}, err
+	}
+	return r, nil
+}
+
+// addColumn adds a column to a table created by an older version, doing
+// nothing if it is already there.
+func addColumn(db *sql.DB, table, def string) error {
+	_, err := db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + def)
+	if err != nil && strings.Contains(err.Error(), "duplicate column name") {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package hub
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Group Rooms ----------------------
+
+// Clients connecting with ?mode=group skip pairing and join a room for
+// their first interest, or the general room without one. A tag gets as
+// many rooms as it needs, each holding up to limits.MaxRoomSize members,
+// and every message fans out to everyone else in the room. Rooms are owned
+// by the run loop and only exist on the instance their members are
+// connected to.
+
+type room struct {
+	tag     string
+	members []*Client
+	// names maps members to the name they are shown under in the room.
+	names    map[*Client]string
+	nextName int
+	lastID   uint64
+}
+
+// joinRoom puts c in the first room for its tag with space left, opening a
+// new one if they are all full.
+func (h *Hub) joinRoom(c *Client) {
+	if c.challenge != nil {
+		return
+	}
+	// Clients that listed no interests have parseInterests' "default".
+	tag := c.interests[0]
+	if tag == "default" {
+		tag = "general"
+	}
+	var r *room
+	for _, candidate := range h.rooms[tag] {
+		if len(candidate.members) < h.limits.MaxRoomSize {
+			r = candidate
+			break
+		}
+	}
+	if r == nil {
+		r = &room{tag: tag, names: make(map[*Client]string)}
+		h.rooms[tag] = append(h.rooms[tag], r)
+	}
+
+	r.nextName++
+	name := "Cat " + strconv.Itoa(r.nextName)
+	r.members = append(r.members, c)
+	r.names[c] = name
+	c.room = r
+
+	h.broadcast(r, c, h.notice("member_joined", client.CodeMemberJoined, map[string]string{"name": name}))
+	code := client.CodeRoomJoined
+	if len(r.members) == 1 {
+		code = client.CodeRoomJoinedAlone
+	}
+	msg := h.notice("room_joined", code, map[string]string{"room": tag, "name": name, "count": strconv.Itoa(len(r.members))})
+	msg.Name = name
+	h.deliver(c, msg)
+}
+
+// leaveRoom takes c out of its room, closing the room once it is empty.
+func (h *Hub) leaveRoom(c *Client) {
+	r := c.room
+	if r == nil {
+		return
+	}
+	c.room = nil
+	name := r.names[c]
+	delete(r.names, c)
+	for i, m := range r.members {
+		if m == c {
+			r.members = append(r.members[:i], r.members[i+1:]...)
+			break
+		}
+	}
+	if len(r.members) > 0 {
+		h.broadcast(r, nil, h.notice("member_left", client.CodeMemberLeft, map[string]string{"name": name}))
+		return
+	}
+	rooms := h.rooms[r.tag]
+	for i, other := range rooms {
+		if other == r {
+			rooms = append(rooms[:i], rooms[i+1:]...)
+			break
+		}
+	}
+	if len(rooms) == 0 {
+		delete(h.rooms, r.tag)
+	} else {
+		h.rooms[r.tag] = rooms
+	}
+}
+
+// roomMessage fans a chat message or typing notification from c out to the
+// rest of its room.
+func (h *Hub) roomMessage(from *Client, msg client.Message) {
+	r := from.room
+	msg.From = client.FromMember
+	msg.Name = r.names[from]
+	h.stamp(&msg, time.Now())
+	switch msg.Type {
+	case "message":
+		h.metrics.messagesRelayed.Inc()
+		r.lastID++
+		msg.ID = r.lastID
+		sent := h.serverMessage("sent", "")
+		sent.ID = msg.ID
+		h.deliver(from, sent)
+	case "media":
+		h.metrics.messagesRelayed.Inc()
+	case "typing_start":
+		msg.Text = msg.Name + " is typing..."
+	case "typing_stop":
+	default:
+		return
+	}
+	h.broadcast(r, from, msg)
+}
+
+// broadcast delivers msg to every member of r except skip.
+func (h *Hub) broadcast(r *room, skip *Client, msg client.Message) {
+	for _, m := range r.members {
+		if m != skip {
+			h.deliver(m, msg)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package hub
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Session Resume ----------------------
+
+// A paired client whose connection drops abnormally is suspended rather
+// than removed: it keeps its place in the pairing, its send channel is
+// closed so its old writePump stops taking messages off it, messages for
+// it are held on the hub instead, and a new connection presenting its
+// session token within limits.ResumeGrace takes its place. The partner is
+// not requeued unless the grace period runs out: it is sent
+// partner_reconnecting with the seconds left instead, and partner_online if
+// the session is resumed.
+
+// sessionToken returns the token that lets a new connection resume id. It
+// is the ID and an HMAC of it under the hub's session key.
+func (h *Hub) sessionToken(id string) string {
+	return id + "." + base64.RawURLEncoding.EncodeToString(h.sessionMAC(id))
+}
+
+// verifySessionToken returns the session ID a token was issued for.
+func (h *Hub) verifySessionToken(token string) (string, bool) {
+	id, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, h.sessionMAC(id)) {
+		return "", false
+	}
+	return id, true
+}
+
+func (h *Hub) sessionMAC(id string) []byte {
+	mac := hmac.New(sha256.New, h.sessionKey)
+	mac.Write([]byte(id))
+	return mac.Sum(nil)
+}
+
+// disconnect handles a client whose readPump has exited.
+func (h *Hub) disconnect(c *Client) {
+	if !h.clients[c] || c.suspended {
+		return
+	}
+	if c.partner == nil || !c.abnormal.Load() || h.limits.ResumeGrace == 0 || h.stopped {
+		h.remove(c)
+		return
+	}
+	c.suspended = true
+	c.log.Info("suspended for resume", "graceSeconds", int(h.limits.ResumeGrace.Seconds()))
+	c.closeSend()
+	c.resumeTimer = time.AfterFunc(h.limits.ResumeGrace, func() { post(h, h.expire, c) })
+	seconds := strconv.Itoa(int(h.limits.ResumeGrace.Round(time.Second) / time.Second))
+	h.tellPartner(c, "partner_reconnecting", client.CodeReconnecting, map[string]string{"seconds": seconds})
+}
+
+// tellPartner sends c's partner a notice about c, through the partner's
+// instance if it is hosted on another.
+func (h *Hub) tellPartner(c *Client, msgType, code string, data map[string]string) {
+	p := c.partner
+	if p == nil {
+		return
+	}
+	if p.remote != "" {
+		h.publish(p.remote, peerEvent{Kind: "presence", From: c.id, To: p.id, Message: &client.Message{Type: msgType, Code: code, Data: data}})
+		return
+	}
+	h.deliver(p, h.notice(msgType, code, data))
+}
+
+// expireSession removes c if it is still suspended once its grace period
+// is over.
+func (h *Hub) expireSession(c *Client) {
+	if c.suspended {
+		h.remove(c)
+	}
+}
+
+// resume hands the suspended session c asks for over to c, which takes
+// the old client's place in its pairing along with the messages buffered
+// for it while it was away. It reports false if there is no such session,
+// in which case c carries on as a new client.
+func (h *Hub) resume(c *Client) bool {
+	var old *Client
+	for cl := range h.clients {
+		if cl.suspended && cl.id == c.resumeID {
+			old = cl
+			break
+		}
+	}
+	if old == nil {
+		return false
+	}
+	old.resumeTimer.Stop()
+	if old.limitTimer != nil {
+		old.limitTimer.Stop()
+	}
+	old.suspended = false
+
+	c.id = old.id
+	c.interests = old.interests
+	c.recent = old.recent
+	c.lastReceived, c.lastAcked = old.lastReceived, old.lastAcked
+	c.partner, c.pairing = old.partner, old.pairing
+	c.partner.partner = c
+	if c.pairing.a == old {
+		c.pairing.a = c
+	} else {
+		c.pairing.b = c
+	}
+	delete(h.clients, old)
+	h.clients[c] = true
+	c.sessionStart = old.sessionStart
+	h.armLimits(c)
+
+	c.log.Info("resumed session", "previous", old.connID)
+	h.deliver(c, h.notice("resumed", client.CodeResumed, nil))
+	for _, msg := range old.held {
+		h.deliver(c, msg)
+	}
+	old.held = nil
+	h.tellPartner(c, "partner_online", client.CodePartnerOnline, nil)
+	return true
+}
@@ -0,0 +1,51 @@
+package hub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestShutdownStopsRun(t *testing.T) {
+	cfg, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := New(cfg, WithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot := h.AddBot("whiskers", []string{"cats"}, BotFunc(func(*BotClient, BotEvent) {}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-h.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run loop still going after shutdown")
+	}
+
+	// Nothing is left to receive from anyone still talking to the hub, which
+	// must not block them.
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		bot.Send("still there?")
+		if snap := h.Snapshot(); len(snap.Clients) != 0 {
+			t.Errorf("snapshot after shutdown has %d clients", len(snap.Clients))
+		}
+		if err := h.Disconnect("nobody"); err != ErrClientNotFound {
+			t.Errorf("Disconnect after shutdown = %v, want %v", err, ErrClientNotFound)
+		}
+		h.Shutdown(ctx)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("hub calls blocked after shutdown")
+	}
+}
@@ -0,0 +1,193 @@
+package hub
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ---------------------- Static File Handler ----------------------
+
+// The frontend is built into the binary, so the server runs from any
+// directory; -static serves an on-disk copy instead, for working on it
+// without rebuilding.
+
+//go:embed static
+var embeddedStatic embed.FS
+
+// staticFiles returns the frontend to serve: dir, or the embedded copy if
+// dir is empty.
+func staticFiles(dir string) http.FileSystem {
+	if dir != "" {
+		return http.Dir(dir)
+	}
+	sub, err := fs.Sub(embeddedStatic, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.FS(sub)
+}
+
+// defaultStaticDeny lists file name patterns (path.Match syntax) that are
+// never served, in addition to anything starting with a dot.
+var defaultStaticDeny = []string{"*.map", "*.bak", "*.swp", "*~"}
+
+// hashedAsset matches fingerprinted file names such as app.3f9a1c2e.js,
+// which are safe to cache forever.
+var hashedAsset = regexp.MustCompile(`\.[0-9a-f]{8,}\.[a-z0-9]+$`)
+
+type staticHandler struct {
+	root http.FileSystem
+	deny []string
+	// etags caches the ETags of files without a modification time, by
+	// name.
+	etags sync.Map
+}
+
+func newStaticHandler(root http.FileSystem, deny []string) *staticHandler {
+	return &staticHandler{root: root, deny: deny}
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Clean("/" + r.URL.Path)
+	if strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+	if h.denied(name) {
+		h.serveError(w, r, http.StatusNotFound)
+		return
+	}
+
+	f, err := h.root.Open(name)
+	if err != nil {
+		h.serveOpenError(w, r, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		h.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	if info.IsDir() {
+		// Never list directories; only serve their index page.
+		f.Close()
+		name = path.Join(name, "index.html")
+		if f, err = h.root.Open(name); err != nil {
+			h.serveOpenError(w, r, err)
+			return
+		}
+		defer f.Close()
+		if info, err = f.Stat(); err != nil || info.IsDir() {
+			h.serveError(w, r, http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", cacheControl(name))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Embedded files have no modification time to revalidate against, so
+	// they get an ETag from their content instead.
+	if info.ModTime().IsZero() {
+		tag, err := h.etag(name, f)
+		if err != nil {
+			h.serveError(w, r, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("ETag", tag)
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// etag returns the ETag for the named file, hashing f the first time and
+// leaving it rewound.
+func (h *staticHandler) etag(name string, f http.File) (string, error) {
+	if tag, ok := h.etags.Load(name); ok {
+		return tag.(string), nil
+	}
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	tag := `"` + hex.EncodeToString(sum.Sum(nil)[:12]) + `"`
+	h.etags.Store(name, tag)
+	return tag, nil
+}
+
+func (h *staticHandler) denied(name string) bool {
+	for _, seg := range strings.Split(name, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return true
+		}
+	}
+	base := path.Base(name)
+	for _, pattern := range h.deny {
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *staticHandler) serveOpenError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		h.serveError(w, r, http.StatusNotFound)
+		return
+	}
+	h.serveError(w, r, http.StatusInternalServerError)
+}
+
+// serveError writes the branded 404.html or 50x.html page from the static
+// set, falling back to a plain-text body if the page is missing.
+func (h *staticHandler) serveError(w http.ResponseWriter, r *http.Request, status int) {
+	page := "/404.html"
+	if status >= 500 {
+		page = "/50x.html"
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	f, err := h.root.Open(page)
+	if err != nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = io.Copy(w, f)
+	}
+}
+
+func cacheControl(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".html"):
+		return "no-cache"
+	case hashedAsset.MatchString(name):
+		return "public, max-age=31536000, immutable"
+	default:
+		return "public, max-age=3600"
+	}
+}
@@ -0,0 +1,212 @@
+package hub
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// diskStatic lays out a frontend under a temporary directory.
+func diskStatic(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"index.html":       "<p>home</p>",
+		"404.html":         "<p>lost cat</p>",
+		"50x.html":         "<p>sick cat</p>",
+		"style.css":        "body { color: black; }",
+		"app.3f9a1c2e.js":  "console.log(1)",
+		"app.js.map":       "{}",
+		"notes.txt~":       "draft",
+		"old.bak":          "old",
+		".env":             "SECRET=1",
+		".git/config":      "[core]",
+		"docs/index.html":  "<p>docs</p>",
+		"empty/readme.txt": "nothing to list",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// brokenFS fails to open /broken.txt with an error other than not found.
+type brokenFS struct{ http.FileSystem }
+
+func (b brokenFS) Open(name string) (http.File, error) {
+	if name == "/broken.txt" {
+		return nil, errors.New("disk on fire")
+	}
+	return b.FileSystem.Open(name)
+}
+
+func serveStatic(h http.Handler, method, target string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestStaticDisk(t *testing.T) {
+	h := newStaticHandler(brokenFS{http.Dir(diskStatic(t))}, defaultStaticDeny)
+	for _, tc := range []struct {
+		path  string
+		code  int
+		body  string
+		cache string
+	}{
+		{"/", http.StatusOK, "<p>home</p>", "no-cache"},
+		{"/index.html", http.StatusOK, "<p>home</p>", "no-cache"},
+		{"/style.css", http.StatusOK, "body { color: black; }", "public, max-age=3600"},
+		{"/app.3f9a1c2e.js", http.StatusOK, "console.log(1)", "public, max-age=31536000, immutable"},
+		{"/docs", http.StatusOK, "<p>docs</p>", "no-cache"},
+		{"/docs/", http.StatusOK, "<p>docs</p>", "no-cache"},
+		{"/empty/", http.StatusNotFound, "<p>lost cat</p>", "no-cache"},
+		{"/empty", http.StatusNotFound, "<p>lost cat</p>", "no-cache"},
+		{"/.env", http.StatusNotFound, "<p>lost cat</p>", "no-cache"},
+		{"/.git/config", http.StatusNotFound, "<p>lost cat</p>", "no-cache"},
+		{"/docs/../.git/config", http.StatusNotFound, "<p>lost cat</p>", "no-cache"},
+		{"/app.js.map", http.StatusNotFound, "<p>lost cat</p>", "no-cache"},
+		{"/notes.txt~", http.StatusNotFound, "<p>lost cat</p>", "no-cache"},
+		{"/old.bak", http.StatusNotFound, "<p>lost cat</p>", "no-cache"},
+		{"/missing.css", http.StatusNotFound, "<p>lost cat</p>", "no-cache"},
+		{"/broken.txt", http.StatusInternalServerError, "<p>sick cat</p>", "no-cache"},
+	} {
+		w := serveStatic(h, http.MethodGet, tc.path)
+		if w.Code != tc.code || w.Body.String() != tc.body {
+			t.Errorf("GET %s = %d %q, want %d %q", tc.path, w.Code, w.Body, tc.code, tc.body)
+		}
+		if got := w.Header().Get("Cache-Control"); got != tc.cache {
+			t.Errorf("GET %s Cache-Control = %q, want %q", tc.path, got, tc.cache)
+		}
+	}
+}
+
+func TestStaticDiskRevalidates(t *testing.T) {
+	h := newStaticHandler(http.Dir(diskStatic(t)), defaultStaticDeny)
+	w := serveStatic(h, http.MethodGet, "/style.css")
+	if tag := w.Header().Get("ETag"); tag != "" {
+		t.Errorf("on-disk file has ETag %s, want Last-Modified only", tag)
+	}
+	modified := w.Header().Get("Last-Modified")
+	if modified == "" {
+		t.Fatal("on-disk file has no Last-Modified")
+	}
+	if w := serveStatic(h, http.MethodGet, "/style.css", "If-Modified-Since", modified); w.Code != http.StatusNotModified {
+		t.Errorf("conditional GET = %d, want %d", w.Code, http.StatusNotModified)
+	}
+	earlier := time.Now().Add(-24 * time.Hour).UTC().Format(http.TimeFormat)
+	if w := serveStatic(h, http.MethodGet, "/style.css", "If-Modified-Since", earlier); w.Code != http.StatusOK {
+		t.Errorf("GET modified since yesterday = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestStaticEmbedded(t *testing.T) {
+	h := newStaticHandler(staticFiles(""), defaultStaticDeny)
+	index, err := fs.ReadFile(embeddedStatic, "static/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notFound, err := fs.ReadFile(embeddedStatic, "static/404.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := serveStatic(h, http.MethodGet, "/")
+	if w.Code != http.StatusOK || w.Body.String() != string(index) {
+		t.Errorf("GET / = %d, want the embedded index.html", w.Code)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("GET / Cache-Control = %q, want no-cache", got)
+	}
+	if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("GET / X-Content-Type-Options = %q, want nosniff", got)
+	}
+	if got := serveStatic(h, http.MethodGet, "/style.css").Header().Get("Cache-Control"); got != "public, max-age=3600" {
+		t.Errorf("GET /style.css Cache-Control = %q, want public, max-age=3600", got)
+	}
+
+	for _, p := range []string{"/.hidden", "/index.html.bak", "/index.html~", "/nope.js"} {
+		w := serveStatic(h, http.MethodGet, p)
+		if w.Code != http.StatusNotFound || w.Body.String() != string(notFound) {
+			t.Errorf("GET %s = %d %q, want the embedded 404 page", p, w.Code, w.Body)
+		}
+		if got := w.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+			t.Errorf("GET %s Content-Type = %q", p, got)
+		}
+	}
+}
+
+func TestStaticEmbeddedETag(t *testing.T) {
+	h := newStaticHandler(staticFiles(""), defaultStaticDeny)
+	w := serveStatic(h, http.MethodGet, "/style.css")
+	tag := w.Header().Get("ETag")
+	if !strings.HasPrefix(tag, `"`) || len(tag) != 26 {
+		t.Fatalf("embedded file ETag = %q, want a quoted content hash", tag)
+	}
+	if w.Header().Get("Last-Modified") != "" {
+		t.Errorf("embedded file has Last-Modified %q", w.Header().Get("Last-Modified"))
+	}
+	if again := serveStatic(h, http.MethodGet, "/style.css").Header().Get("ETag"); again != tag {
+		t.Errorf("ETag changed from %s to %s", tag, again)
+	}
+	if other := serveStatic(h, http.MethodGet, "/index.html").Header().Get("ETag"); other == tag {
+		t.Errorf("index.html and style.css share ETag %s", tag)
+	}
+	if w := serveStatic(h, http.MethodGet, "/style.css", "If-None-Match", tag); w.Code != http.StatusNotModified {
+		t.Errorf("conditional GET = %d, want %d", w.Code, http.StatusNotModified)
+	}
+	if w := serveStatic(h, http.MethodGet, "/style.css", "If-None-Match", `"stale"`); w.Code != http.StatusOK {
+		t.Errorf("GET with a stale ETag = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestStaticMethods(t *testing.T) {
+	for name, root := range map[string]http.FileSystem{
+		"disk":     http.Dir(diskStatic(t)),
+		"embedded": staticFiles(""),
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := newStaticHandler(root, defaultStaticDeny)
+			full := serveStatic(h, http.MethodGet, "/style.css").Body.String()
+
+			w := serveStatic(h, http.MethodHead, "/style.css")
+			if w.Code != http.StatusOK || w.Body.Len() != 0 {
+				t.Errorf("HEAD = %d with %d bytes, want 200 and no body", w.Code, w.Body.Len())
+			}
+			if w.Header().Get("Content-Length") == "" {
+				t.Error("HEAD has no Content-Length")
+			}
+			if w := serveStatic(h, http.MethodHead, "/.env"); w.Code != http.StatusNotFound || w.Body.Len() != 0 {
+				t.Errorf("HEAD /.env = %d with %d bytes, want 404 and no body", w.Code, w.Body.Len())
+			}
+
+			w = serveStatic(h, http.MethodGet, "/style.css", "Range", "bytes=0-3")
+			if w.Code != http.StatusPartialContent || w.Body.String() != full[:4] {
+				t.Errorf("GET bytes=0-3 = %d %q, want 206 %q", w.Code, w.Body, full[:4])
+			}
+			if got := w.Header().Get("Content-Range"); !strings.HasPrefix(got, "bytes 0-3/") {
+				t.Errorf("Content-Range = %q", got)
+			}
+
+			w = serveStatic(h, http.MethodPost, "/style.css")
+			if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, HEAD" {
+				t.Errorf("POST = %d, Allow %q, want 405 and GET, HEAD", w.Code, w.Header().Get("Allow"))
+			}
+		})
+	}
+}
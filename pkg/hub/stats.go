@@ -0,0 +1,42 @@
+package hub
+
+import (
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Presence Stats ----------------------
+
+// statsMessage counts for c. It runs on the run loop, and the message is
+// written by c's writePump like any other.
+func (h *Hub) statsMessage(c *Client) client.Message {
+	stats := client.Stats{Online: len(h.clients)}
+	for _, w := range h.waiting {
+		if w != c && len(sharedInterests(c.interests, w.interests)) > 0 {
+			stats.Waiting++
+		}
+	}
+	msg := h.serverMessage("stats", "")
+	msg.Stats = &stats
+	return msg
+}
+
+// broadcastStats sends every connected client its stats.
+func (h *Hub) broadcastStats() {
+	for c := range h.clients {
+		if !c.suspended {
+			h.deliver(c, h.statsMessage(c))
+		}
+	}
+}
+
+// statsTicker returns the channel that paces stats broadcasts, or nil if
+// they are disabled.
+func (h *Hub) statsTicker() (<-chan time.Time, func()) {
+	if h.limits.StatsInterval <= 0 {
+		return nil, func() {}
+	}
+	t := time.NewTicker(h.limits.StatsInterval)
+	return t.C, t.Stop
+}
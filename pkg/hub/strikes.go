@@ -0,0 +1,84 @@
+package hub
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// ---------------------- Strikes ----------------------
+
+// Confirmed reports and disconnect-level filter hits each give the
+// offending address a strike. Reaching limits.StrikeLimit within
+// limits.StrikeWindow bans the address for limits.StrikeBan. Strikes are
+// kept in memory; the bans they lead to go to the ban store like any
+// other.
+
+type strikeTracker struct {
+	limit  int
+	window time.Duration
+
+	mu      sync.Mutex
+	strikes map[netip.Addr][]time.Time
+}
+
+func newStrikeTracker(limits Limits) *strikeTracker {
+	return &strikeTracker{
+		limit:   limits.StrikeLimit,
+		window:  limits.StrikeWindow,
+		strikes: make(map[netip.Addr][]time.Time),
+	}
+}
+
+// add records a strike against ip and reports whether it reached the
+// limit, in which case the count starts over.
+func (t *strikeTracker) add(ip netip.Addr, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	recent := t.strikes[ip][:0]
+	for _, at := range t.strikes[ip] {
+		if now.Sub(at) < t.window {
+			recent = append(recent, at)
+		}
+	}
+	recent = append(recent, now)
+	if len(recent) >= t.limit {
+		delete(t.strikes, ip)
+		return true
+	}
+	t.strikes[ip] = recent
+	return false
+}
+
+// strike gives ip a strike for reason, banning it and disconnecting its
+// clients once it has too many. It reports whether ip was banned. It must
+// not be called from the run loop.
+func (h *Hub) strike(ip netip.Addr, reason string) bool {
+	if !ip.IsValid() {
+		return false
+	}
+	h.metrics.strikes.WithLabelValues(reason).Inc()
+	now := time.Now()
+	if !h.strikes.add(ip, now) {
+		return false
+	}
+	expires := now.Add(h.limits.StrikeBan)
+	ban := &Ban{
+		Prefix:    netip.PrefixFrom(ip, ip.BitLen()),
+		Reason:    "automatic: too many strikes, last for " + reason,
+		CreatedAt: now,
+		ExpiresAt: &expires,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.limits.StoreTimeout)
+	defer cancel()
+	if err := h.bans.Add(ctx, ban); err != nil {
+		slog.Error("adding automatic ban", "err", err)
+		return false
+	}
+	slog.Info("banned address after strikes", "ip", ip, "until", expires, "strikes", h.limits.StrikeLimit, "reason", reason)
+	h.notifyBan(ban, true)
+	h.do(func() { h.enforceBan(*ban) })
+	return true
+}
@@ -0,0 +1,63 @@
+package hub
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ---------------------- Tracing ----------------------
+
+// With -otlp-endpoint set, catchat exports OpenTelemetry spans over OTLP
+// for the steps where latency builds up under load: the WebSocket upgrade
+// (including the wait for the run loop to register the client), matching,
+// relaying chat messages (from the moment readPump queued them) and
+// tearing a client down. Spans about a pairing carry its ID as
+// catchat.pair.id, so one chat can be followed from match to teardown.
+// The hub traces through the global tracer provider, which cmd/catchat
+// installs; without an endpoint it is the no-op one and costs nothing.
+
+const tracerName = "github.com/Azeem01nnie/CatChat"
+
+// Span attribute keys.
+const (
+	attrConnID  = attribute.Key("catchat.conn.id")
+	attrPairID  = attribute.Key("catchat.pair.id")
+	attrMsgType = attribute.Key("catchat.message.type")
+	attrMatched = attribute.Key("catchat.matched")
+	attrReason  = attribute.Key("catchat.disconnect.reason")
+)
+
+// startSpan starts a span about c, and its pairing if it has one.
+func (h *Hub) startSpan(ctx context.Context, name string, c *Client, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx, span := h.tracer.Start(ctx, name, opts...)
+	span.SetAttributes(attrConnID.String(c.connID))
+	if c.pairing != nil {
+		span.SetAttributes(attrPairID.String(c.pairing.id))
+	}
+	return ctx, span
+}
+
+// endMatchSpan ends a matching span, recording whether c came out of it
+// paired.
+func endMatchSpan(span trace.Span, c *Client) {
+	span.SetAttributes(attrMatched.Bool(c.pairing != nil))
+	if c.pairing != nil {
+		span.SetAttributes(attrPairID.String(c.pairing.id))
+	}
+	span.End()
+}
+
+// relaySpan starts the span for r on the run loop, backdated to when
+// readPump queued it. Requests that weren't timed are not traced.
+func (h *Hub) relaySpan(r relayRequest) trace.Span {
+	if r.queued.IsZero() {
+		return trace.SpanFromContext(context.Background())
+	}
+	_, span := h.startSpan(context.Background(), "catchat.relay", r.from,
+		trace.WithTimestamp(r.queued), trace.WithAttributes(attrMsgType.String(r.msg.Type)))
+	span.AddEvent("dequeued", trace.WithTimestamp(time.Now()))
+	return span
+}
@@ -0,0 +1,60 @@
+package hub
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/client"
+)
+
+// ---------------------- Typing Indicator ----------------------
+
+// Clients send typing_start while the user types and typing_stop when they
+// pause. readPump relays a start at most once per limits.TypingThrottle
+// however often the client repeats it, and if no stop or message follows
+// within limits.TypingTimeout it relays the stop itself, so a partner's
+// indicator never sticks. The legacy "typing" message counts as a start.
+
+type typingState struct {
+	mu        sync.Mutex
+	active    bool
+	lastRelay time.Time
+	expiry    *time.Timer
+}
+
+// typingStart relays a start for c unless one went out within the
+// throttle window, and pushes back the automatic stop.
+func (c *Client) typingStart(now time.Time) {
+	t := &c.typing
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	limits := c.hub.limits
+	if !t.active || now.Sub(t.lastRelay) >= limits.TypingThrottle {
+		t.lastRelay = now
+		post(c.hub, c.hub.relay, relayRequest{from: c, msg: client.Message{Type: "typing_start", Text: "Partner is typing..."}})
+	}
+	t.active = true
+	if t.expiry == nil {
+		t.expiry = time.AfterFunc(limits.TypingTimeout, func() { c.typingStop(true) })
+	} else {
+		t.expiry.Reset(limits.TypingTimeout)
+	}
+}
+
+// typingStop clears c's indicator, relaying the stop if relay is set; a
+// chat message clears it without one, since it implies the stop.
+func (c *Client) typingStop(relay bool) {
+	t := &c.typing
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.active {
+		return
+	}
+	t.active = false
+	if t.expiry != nil {
+		t.expiry.Stop()
+	}
+	if relay {
+		post(c.hub, c.hub.relay, relayRequest{from: c, msg: client.Message{Type: "typing_stop"}})
+	}
+}
@@ -0,0 +1,235 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ---------------------- Webhooks ----------------------
+
+// Events worth telling outside tooling about, such as a moderation queue
+// or a chat channel, are POSTed as JSON to every configured webhook URL:
+//
+//	{"id": "...", "event": "report_filed", "time": "...", "data": {...}}
+//
+// Each request carries the event in X-CatChat-Event, its ID in
+// X-CatChat-Delivery and, with a secret set, an X-CatChat-Signature of
+// "sha256=" and the hex HMAC-SHA256 of the X-CatChat-Timestamp value, a
+// dot and the body, so receivers can check it came from us and is fresh.
+// Deliveries that fail or get a non-2xx answer are retried with backoff;
+// events are dropped rather than queued without bound when receivers
+// can't keep up.
+
+// Webhook events.
+const (
+	EventReportFiled      = "report_filed"
+	EventUserBanned       = "user_banned"
+	EventPairCreated      = "pair_created"
+	EventServerOverloaded = "server_overloaded"
+)
+
+// webhookEvents lists the events -webhook-events accepts.
+var webhookEvents = []string{EventReportFiled, EventUserBanned, EventPairCreated, EventServerOverloaded}
+
+// webhookPayload is the body of a webhook request.
+type webhookPayload struct {
+	ID    string    `json:"id"`
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	Data  any       `json:"data"`
+}
+
+// webhookDispatcher delivers events on a goroutine of its own. A nil
+// dispatcher, used when no URLs are configured, drops everything.
+type webhookDispatcher struct {
+	urls    []string
+	secret  []byte
+	events  map[string]bool
+	limits  Limits
+	client  *http.Client
+	metrics *metrics
+
+	// mu guards closed, which is set once Close has closed queue, so late
+	// senders such as a slow report save drop their event instead.
+	mu     sync.Mutex
+	closed bool
+	queue  chan webhookPayload
+	done   chan struct{}
+}
+
+// newWebhookDispatcher starts delivering the given events, or all of them
+// if events is empty, to urls. It returns nil if there are no URLs.
+func newWebhookDispatcher(urls []string, secret string, events []string, limits Limits, m *metrics) *webhookDispatcher {
+	if len(urls) == 0 {
+		return nil
+	}
+	d := &webhookDispatcher{
+		urls:    urls,
+		secret:  []byte(secret),
+		limits:  limits,
+		client:  &http.Client{Timeout: limits.WebhookTimeout},
+		metrics: m,
+		queue:   make(chan webhookPayload, limits.WebhookQueueSize),
+		done:    make(chan struct{}),
+	}
+	if len(events) > 0 {
+		d.events = make(map[string]bool)
+		for _, e := range events {
+			d.events[e] = true
+		}
+	}
+	go d.run()
+	return d
+}
+
+// send queues event for delivery without blocking. data is marshalled as
+// the payload's data.
+func (d *webhookDispatcher) send(event string, data any) {
+	if d == nil || (d.events != nil && !d.events[event]) {
+		return
+	}
+	p := webhookPayload{ID: newSessionID(), Event: event, Time: time.Now().UTC(), Data: data}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		d.metrics.webhooks.WithLabelValues(event, "dropped").Inc()
+		slog.Warn("webhooks closed, dropping event", "event", event)
+		return
+	}
+	select {
+	case d.queue <- p:
+	default:
+		d.metrics.webhooks.WithLabelValues(event, "dropped").Inc()
+		slog.Warn("webhook queue full, dropping event", "event", event)
+	}
+}
+
+// Close stops taking events, dropping any sent later, and waits until the
+// queued ones have been delivered or ctx is done.
+func (d *webhookDispatcher) Close(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *webhookDispatcher) run() {
+	defer close(d.done)
+	for p := range d.queue {
+		body, err := json.Marshal(p)
+		if err != nil {
+			slog.Error("encoding webhook", "event", p.Event, "err", err)
+			continue
+		}
+		for _, url := range d.urls {
+			result := "delivered"
+			if err := d.deliver(url, p, body); err != nil {
+				result = "failed"
+				slog.Error("delivering webhook", "event", p.Event, "url", url, "err", err)
+			}
+			d.metrics.webhooks.WithLabelValues(p.Event, result).Inc()
+		}
+	}
+}
+
+// deliver POSTs body to url, retrying with backoff.
+func (d *webhookDispatcher) deliver(url string, p webhookPayload, body []byte) error {
+	wait := d.limits.WebhookBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = d.post(url, p, body); err == nil {
+			return nil
+		}
+		if attempt == d.limits.WebhookAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+func (d *webhookDispatcher) post(url string, p webhookPayload, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CatChat-Webhook")
+	req.Header.Set("X-CatChat-Event", p.Event)
+	req.Header.Set("X-CatChat-Delivery", p.ID)
+	req.Header.Set("X-CatChat-Timestamp", timestamp)
+	if len(d.secret) > 0 {
+		req.Header.Set("X-CatChat-Signature", "sha256="+webhookSignature(d.secret, timestamp, body))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return nil
+}
+
+// webhookSignature is the hex HMAC-SHA256 of timestamp, a dot and body.
+func webhookSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ---------------------- Event Data ----------------------
+
+type reportFiledEvent struct {
+	ReportID   int64  `json:"reportId"`
+	ReporterID string `json:"reporterId"`
+	ReportedID string `json:"reportedId"`
+	ReportedIP string `json:"reportedIp,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+type userBannedEvent struct {
+	BanID     int64      `json:"banId"`
+	CIDR      string     `json:"cidr"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Automatic is set for bans given for too many strikes.
+	Automatic bool `json:"automatic"`
+}
+
+type pairCreatedEvent struct {
+	PairID string   `json:"pairId"`
+	A      string   `json:"a"`
+	B      string   `json:"b"`
+	Shared []string `json:"shared,omitempty"`
+}
+
+type serverOverloadedEvent struct {
+	Connections    int `json:"connections"`
+	MaxConnections int `json:"maxConnections"`
+}
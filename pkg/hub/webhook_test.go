@@ -0,0 +1,41 @@
+package hub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWebhookSendAfterClose(t *testing.T) {
+	var got atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.Add(1)
+	}))
+	defer srv.Close()
+
+	d := newWebhookDispatcher([]string{srv.URL}, "", nil, DefaultLimits(), newMetrics(prometheus.NewRegistry(), nil))
+	d.send(EventReportFiled, reportFiledEvent{ReportID: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := got.Load(); n != 1 {
+		t.Fatalf("%d deliveries before Close returned, want 1", n)
+	}
+
+	// A report saved, or a ban made, during shutdown sends late.
+	d.send(EventReportFiled, reportFiledEvent{ReportID: 2})
+	d.send(EventUserBanned, userBannedEvent{BanID: 1})
+	if err := d.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := got.Load(); n != 1 {
+		t.Errorf("%d deliveries, want the late events dropped", n)
+	}
+}
@@ -0,0 +1,131 @@
+package hub
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azeem01nnie/CatChat/pkg/profanity"
+)
+
+// ---------------------- Word List ----------------------
+
+var errNoWordList = errors.New("no word list file configured")
+
+// wordList holds the profanity filter in use and reloads it from its file.
+// Readers get the current filter without locking; a reload swaps in a new
+// one atomically.
+type wordList struct {
+	path   string
+	filter atomic.Pointer[profanity.Filter]
+
+	// mu serialises reloads and guards modTime.
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+// loadWordList reads the word list at path, or uses the built-in defaults
+// if path is empty.
+func loadWordList(path string) (*wordList, error) {
+	wl := &wordList{path: path}
+	if path == "" {
+		wl.filter.Store(profanity.New(defaultBlockedWords...))
+		return wl, nil
+	}
+	if _, err := wl.Reload(); err != nil {
+		return nil, err
+	}
+	return wl, nil
+}
+
+func (wl *wordList) Filter() *profanity.Filter {
+	return wl.filter.Load()
+}
+
+// Reload rereads the file and returns the number of words loaded. On error
+// the previous list stays in use.
+func (wl *wordList) Reload() (int, error) {
+	if wl.path == "" {
+		return 0, errNoWordList
+	}
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+
+	f, err := os.Open(wl.path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	rules, err := parseWordList(f)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", wl.path, err)
+	}
+	wl.filter.Store(profanity.NewRules(rules...))
+	wl.modTime = info.ModTime()
+	return len(rules), nil
+}
+
+// watch reloads the list whenever the file's modification time changes,
+// checking every interval until ctx is done.
+func (wl *wordList) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(wl.path)
+		if err != nil {
+			slog.Error("checking word list", "err", err)
+			continue
+		}
+		wl.mu.Lock()
+		changed := !info.ModTime().Equal(wl.modTime)
+		wl.mu.Unlock()
+		if !changed {
+			continue
+		}
+		if n, err := wl.Reload(); err != nil {
+			slog.Error("reloading word list", "err", err)
+		} else {
+			slog.Info("reloaded word list", "words", n)
+		}
+	}
+}
+
+// parseWordList reads one blocked word per line. A line may end with a
+// severity, "censor" (the default), "warn" or "disconnect", separated from
+// the word by whitespace. Blank lines and lines starting with # are
+// skipped.
+func parseWordList(r io.Reader) ([]profanity.Rule, error) {
+	var rules []profanity.Rule
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		rule := profanity.Rule{Word: text}
+		if i := strings.LastIndexAny(text, " \t"); i >= 0 {
+			if sev, err := profanity.ParseSeverity(text[i+1:]); err == nil {
+				rule = profanity.Rule{Word: strings.TrimSpace(text[:i]), Severity: sev}
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, sc.Err()
+}
@@ -0,0 +1,212 @@
+// Package profanity masks blocked words in chat text. It is used by the
+// CatChat server and can be imported by other services that want the same
+// filtering behaviour.
+package profanity
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Mask is written in place of every blocked word.
+const Mask = "****"
+
+// Filter matches a fixed set of blocked words as whole words, ignoring
+// ASCII case and common leet-speak substitutions, so "B4dW0rd" is caught
+// but a blocked "ass" leaves "class" alone. Text that doesn't match is
+// passed through unchanged. A Filter is safe for concurrent use.
+type Filter struct {
+	rules  []rule
+	maxLen int
+}
+
+type rule struct {
+	pattern  []byte
+	severity Severity
+}
+
+// Severity says what a blocked word should cost the person who wrote it.
+// Every blocked word is masked; the severity adds to that.
+type Severity int
+
+const (
+	// Censor only masks the word.
+	Censor Severity = iota
+	// Warn masks the word and warns the sender.
+	Warn
+	// Disconnect drops the message and disconnects the sender.
+	Disconnect
+)
+
+var severityNames = []string{"censor", "warn", "disconnect"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity parses "censor", "warn" or "disconnect".
+func ParseSeverity(name string) (Severity, error) {
+	for i, n := range severityNames {
+		if strings.EqualFold(name, n) {
+			return Severity(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %q", name)
+}
+
+// Rule is a blocked word with its severity.
+type Rule struct {
+	Word     string
+	Severity Severity
+}
+
+// Result is the outcome of masking a string. Severity is the highest
+// severity among the words masked, and Censor if there were none.
+type Result struct {
+	Text     string
+	Hits     int
+	Severity Severity
+}
+
+// New builds a Filter that censors a list of blocked words. Empty words
+// are ignored.
+func New(words ...string) *Filter {
+	rules := make([]Rule, len(words))
+	for i, w := range words {
+		rules[i] = Rule{Word: w}
+	}
+	return NewRules(rules...)
+}
+
+// NewRules builds a Filter from blocked words with individual severities.
+// Empty words are ignored.
+func NewRules(rules ...Rule) *Filter {
+	f := &Filter{}
+	for _, r := range rules {
+		if r.Word == "" {
+			continue
+		}
+		pattern := []byte(r.Word)
+		for i, c := range pattern {
+			pattern[i] = fold(c)
+		}
+		f.rules = append(f.rules, rule{pattern: pattern, severity: r.Severity})
+		if len(pattern) > f.maxLen {
+			f.maxLen = len(pattern)
+		}
+	}
+	return f
+}
+
+// Len reports how many blocked words f matches.
+func (f *Filter) Len() int {
+	return len(f.rules)
+}
+
+// MaskString replaces every blocked word in s with Mask.
+func (f *Filter) MaskString(s string) Result {
+	var b strings.Builder
+	_, hits, sev := f.mask(&b, []byte(s), 0, true)
+	return Result{Text: b.String(), Hits: hits, Severity: sev}
+}
+
+// mask writes buf to dst with blocked words replaced; prev is the byte
+// that came before buf, or 0 at the start of the text. Unless final is set,
+// it stops short of the last maxLen bytes, since a match starting there
+// could still be completed, or its word extended, by later input. It
+// reports how much of buf it consumed, how many words it masked and their
+// highest severity.
+func (f *Filter) mask(dst io.ByteWriter, buf []byte, prev byte, final bool) (consumed, hits int, sev Severity) {
+	i := 0
+	for i < len(buf) {
+		if !final && len(buf)-i <= f.maxLen {
+			break
+		}
+		if i > 0 {
+			prev = buf[i-1]
+		}
+		if n, s := f.matchAt(buf[i:]); n > 0 && !isWordByte(prev) {
+			for j := 0; j < len(Mask); j++ {
+				dst.WriteByte(Mask[j])
+			}
+			i += n
+			hits++
+			sev = max(sev, s)
+			continue
+		}
+		dst.WriteByte(buf[i])
+		i++
+	}
+	return i, hits, sev
+}
+
+// matchAt returns the length and severity of the longest rule that
+// prefixes buf and ends on a word boundary, or 0. Of equally long rules the
+// most severe wins. A match made only of digits and symbols, such as
+// "455", is not counted.
+func (f *Filter) matchAt(buf []byte) (int, Severity) {
+	best, sev := 0, Censor
+	for _, r := range f.rules {
+		n := len(r.pattern)
+		if n < best || n == best && r.severity <= sev || n > len(buf) {
+			continue
+		}
+		if n < len(buf) && isWordByte(buf[n]) {
+			continue
+		}
+		if hasFoldPrefix(buf, r.pattern) && hasLetter(buf[:n]) {
+			best, sev = n, r.severity
+		}
+	}
+	return best, sev
+}
+
+func hasFoldPrefix(buf, rule []byte) bool {
+	for i, c := range rule {
+		if fold(buf[i]) != c {
+			return false
+		}
+	}
+	return true
+}
+
+// leet maps the digits and symbols commonly typed in place of letters.
+var leet = [256]byte{
+	'4': 'a', '@': 'a',
+	'3': 'e',
+	'1': 'i', '!': 'i',
+	'0': 'o',
+	'5': 's', '$': 's',
+	'7': 't',
+}
+
+// fold lower-cases ASCII letters and undoes leet substitutions.
+func fold(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	if l := leet[b]; l != 0 {
+		return l
+	}
+	return b
+}
+
+// isWordByte reports whether b can be part of a word. Bytes of multi-byte
+// UTF-8 sequences count, so a rule never matches the ASCII prefix of a
+// longer non-ASCII word.
+func isWordByte(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || b == '_' || b >= 0x80
+}
+
+func hasLetter(buf []byte) bool {
+	for _, b := range buf {
+		if 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' {
+			return true
+		}
+	}
+	return false
+}
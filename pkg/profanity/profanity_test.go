@@ -0,0 +1,145 @@
+package profanity
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func testFilter() *Filter {
+	return NewRules(
+		Rule{Word: "badword"},
+		Rule{Word: "ass", Severity: Warn},
+		Rule{Word: "darn", Severity: Disconnect},
+	)
+}
+
+func TestMaskString(t *testing.T) {
+	f := testFilter()
+	for _, tc := range []struct {
+		in   string
+		want Result
+	}{
+		{"", Result{Text: ""}},
+		{"B4dW0rd", Result{Text: Mask, Hits: 1}},
+		{"Hello BadWord, World!", Result{Text: "Hello ****, World!", Hits: 1}},
+		{"class", Result{Text: "class"}},
+		{"a class ass", Result{Text: "a class ****", Hits: 1, Severity: Warn}},
+		{"ASS", Result{Text: Mask, Hits: 1, Severity: Warn}},
+		{"455", Result{Text: "455"}},
+		{"455 4ss", Result{Text: "455 ****", Hits: 1, Severity: Warn}},
+		{"badwords xbadword badword_", Result{Text: "badwords xbadword badword_"}},
+		{"darn ass", Result{Text: "**** ****", Hits: 2, Severity: Disconnect}},
+		{"café ass assé", Result{Text: "café **** assé", Hits: 1, Severity: Warn}},
+	} {
+		if got := f.MaskString(tc.in); got != tc.want {
+			t.Errorf("MaskString(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestMatchAt(t *testing.T) {
+	f := NewRules(
+		Rule{Word: "bad"},
+		Rule{Word: "badword"},
+		Rule{Word: "ass", Severity: Warn},
+		Rule{Word: "ass", Severity: Disconnect},
+	)
+	for _, tc := range []struct {
+		in  string
+		n   int
+		sev Severity
+	}{
+		{"", 0, Censor},
+		{"bad day", 3, Censor},
+		{"badword day", 7, Censor},
+		{"B4DW0RD", 7, Censor},
+		{"badwords", 0, Censor},
+		{"badw", 0, Censor},
+		{"ass!", 3, Disconnect},
+		{"455", 0, Censor},
+		{"class", 0, Censor},
+	} {
+		n, sev := f.matchAt([]byte(tc.in))
+		if n != tc.n || sev != tc.sev {
+			t.Errorf("matchAt(%q) = %d, %s, want %d, %s", tc.in, n, sev, tc.n, tc.sev)
+		}
+	}
+}
+
+func TestWriterSplit(t *testing.T) {
+	f := testFilter()
+	for _, tc := range []struct {
+		in    string
+		split int
+		want  string
+	}{
+		{"bad badword", 4, "bad ****"},
+		{"badword badword", 7, "**** ****"},
+		{"badword badword", 8, "**** ****"},
+		{"badword_ badword", 7, "badword_ ****"},
+		{"a class ass", 7, "a class ****"},
+		{"a cl ass", 4, "a cl ****"},
+		{"a class", 4, "a class"},
+	} {
+		if got := writeSplit(t, f, tc.in, tc.split).Text; got != tc.want {
+			t.Errorf("writing %q split at %d = %q, want %q", tc.in, tc.split, got, tc.want)
+		}
+	}
+}
+
+// writeSplit writes s to a Writer in two calls, split at i, and returns
+// what came out.
+func writeSplit(t testing.TB, f *Filter, s string, i int) Result {
+	var b strings.Builder
+	w := f.NewWriter(&b)
+	if _, err := w.Write([]byte(s[:i])); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(s[i:])); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return Result{Text: b.String(), Hits: w.Hits(), Severity: w.Severity()}
+}
+
+func FuzzWriter(f *testing.F) {
+	for _, s := range []string{
+		"",
+		"a badword here",
+		"B4dW0rd",
+		"class ass 455",
+		"darn_it darn",
+		"badwordbadword badword",
+		"café ass",
+	} {
+		f.Add(s)
+	}
+	filter := testFilter()
+	f.Fuzz(func(t *testing.T, s string) {
+		want := filter.MaskString(s)
+		for i := 0; i <= len(s); i++ {
+			if got := writeSplit(t, filter, s, i); got != want {
+				t.Fatalf("split %q at %d: got %+v, want %+v", s, i, got, want)
+			}
+		}
+	})
+}
+
+func BenchmarkWriter(b *testing.B) {
+	f := testFilter()
+	text := []byte(strings.Repeat("some ordinary chat with a badword and a cl4ss act, ", 64))
+	b.SetBytes(int64(len(text)))
+	for i := 0; i < b.N; i++ {
+		w := f.NewWriter(io.Discard)
+		// Odd-sized chunks put words across Write calls.
+		for p := text; len(p) > 0; {
+			n := min(37, len(p))
+			w.Write(p[:n])
+			p = p[n:]
+		}
+		w.Close()
+	}
+}
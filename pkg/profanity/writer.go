@@ -0,0 +1,66 @@
+package profanity
+
+import (
+	"bytes"
+	"io"
+)
+
+// Writer masks blocked words in everything written to it before passing it
+// on to the underlying writer. A word split across two Write calls is still
+// caught: up to one rule's length of input, plus a byte to check the word
+// ends there, is held back until more data arrives or Close is called.
+type Writer struct {
+	f     *Filter
+	w     io.Writer
+	carry []byte
+	// prev is the last byte passed on, for the word-boundary check.
+	prev byte
+	out  bytes.Buffer
+	hits int
+	sev  Severity
+}
+
+// NewWriter returns a Writer that filters into w.
+func (f *Filter) NewWriter(w io.Writer) *Writer {
+	return &Writer{f: f, w: w}
+}
+
+// Write implements io.Writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.carry = append(w.carry, p...)
+	if err := w.drain(false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close flushes any held-back input. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	return w.drain(true)
+}
+
+// Hits reports how many blocked words have been masked so far.
+func (w *Writer) Hits() int {
+	return w.hits
+}
+
+// Severity reports the highest severity among the words masked so far.
+func (w *Writer) Severity() Severity {
+	return w.sev
+}
+
+func (w *Writer) drain(final bool) error {
+	w.out.Reset()
+	n, hits, sev := w.f.mask(&w.out, w.carry, w.prev, final)
+	w.hits += hits
+	w.sev = max(w.sev, sev)
+	if n > 0 {
+		w.prev = w.carry[n-1]
+	}
+	w.carry = append(w.carry[:0], w.carry[n:]...)
+	if w.out.Len() == 0 {
+		return nil
+	}
+	_, err := w.w.Write(w.out.Bytes())
+	return err
+}